@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"home-ci-cd/config"
+	"home-ci-cd/db"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// errCommandFailed is returned by commands that already reported the failure and only set the exit status.
+var errCommandFailed = errors.New("command failed")
+
+const (
+	shortCommitLength = 7
+	timeLayout        = "2006-01-02 15:04:05"
+)
+
+// openStorage loads the config and opens the database it points to.
+// Commands only reading history open it readOnly, which works next to other readers only.
+func openStorage(configPath string, readOnly bool) (*config.Organizer, config.Config, *db.BoltDB, error) {
+	configOrganizer, err := config.NewOrganizer(configPath)
+	if err != nil {
+		return nil, config.Config{}, nil, err
+	}
+
+	cfg, err := configOrganizer.Load()
+	if err != nil {
+		_ = configOrganizer.Close()
+		return nil, config.Config{}, nil, err
+	}
+
+	database, err := db.NewBoltDB(cfg.Database, readOnly)
+	if err != nil {
+		_ = configOrganizer.Close()
+		return nil, config.Config{}, nil, err
+	}
+
+	return configOrganizer, cfg, database, nil
+}
+
+func closeStorage(configOrganizer *config.Organizer, database *db.BoltDB) {
+	if err := configOrganizer.Close(); err != nil {
+		zap.L().Error(err.Error())
+	}
+	if err := database.Close(); err != nil {
+		zap.L().Error(err.Error())
+	}
+}
+
+// splitRepository splits a repository given in owner/name form.
+func splitRepository(repository string) (string, string, bool) {
+	owner, repo, ok := strings.Cut(repository, "/")
+	if !ok || owner == "" || repo == "" {
+		return "", "", false
+	}
+
+	return owner, repo, true
+}
+
+func shortCommit(commit string) string {
+	if len(commit) > shortCommitLength {
+		return commit[:shortCommitLength]
+	}
+
+	return commit
+}
+
+// orDash shows runs recorded before a field existed.
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+
+	return s
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+
+	return t.Local().Format(timeLayout)
+}
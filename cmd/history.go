@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"home-ci-cd/db"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	defaultHistoryLimit = 20
+)
+
+// printHistory prints past runs, newest first.
+func printHistory(args []string) error {
+	fs := flag.NewFlagSet(historyCommand, flag.ExitOnError)
+
+	var configPath, repository, branch, pipeline string
+	var limit int
+	fs.StringVar(&configPath, "c", "", "path to config file")
+	fs.StringVar(&repository, "repo", "", "show only runs of the repository in owner/name form")
+	fs.StringVar(&branch, "branch", "", "show only runs of the branch")
+	fs.StringVar(&pipeline, "pipeline", "", "show only runs of the pipeline template")
+	fs.IntVar(&limit, "n", defaultHistoryLimit, "maximum number of runs, 0 for all")
+	_ = fs.Parse(args)
+
+	filter := db.RunFilter{
+		Branch:   branch,
+		Pipeline: pipeline,
+		Limit:    limit,
+	}
+	if repository != "" {
+		owner, repo, ok := splitRepository(repository)
+		if !ok {
+			fs.Usage()
+			os.Exit(2)
+		}
+		filter.Owner, filter.Repo = owner, repo
+	}
+
+	configOrganizer, _, database, err := openStorage(configPath, true)
+	if err != nil {
+		return err
+	}
+	defer closeStorage(configOrganizer, database)
+
+	runs, err := database.ListRuns(context.Background(), filter)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "ID\tREPOSITORY\tBRANCH\tPIPELINE\tCOMMIT\tTRIGGER\tSTATUS\tSTARTED\tDURATION\tREASON")
+
+	for _, run := range runs {
+		duration := "-"
+		if !run.FinishedAt.IsZero() {
+			duration = run.FinishedAt.Sub(run.StartedAt).Round(time.Second).String()
+		}
+
+		_, _ = fmt.Fprintf(
+			w,
+			"%d\t%s/%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			run.ID,
+			run.Owner,
+			run.Repo,
+			run.Branch,
+			orDash(run.Pipeline),
+			shortCommit(run.Commit),
+			run.Trigger,
+			run.Status,
+			formatTime(run.StartedAt),
+			duration,
+			run.Reason,
+		)
+	}
+
+	return w.Flush()
+}
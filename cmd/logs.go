@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// printLogs prints the stored log of a run.
+func printLogs(args []string) error {
+	fs := flag.NewFlagSet(logsCommand, flag.ExitOnError)
+	fs.Usage = func() {
+		_, _ = fmt.Fprintf(fs.Output(), "Usage of %s: %s [-c config] <run-id>\n", logsCommand, logsCommand)
+		fs.PrintDefaults()
+	}
+
+	var configPath string
+	fs.StringVar(&configPath, "c", "", "path to config file")
+	_ = fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	id, err := strconv.ParseUint(fs.Arg(0), 10, 64)
+	if err != nil {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	configOrganizer, _, database, err := openStorage(configPath, true)
+	if err != nil {
+		return err
+	}
+	defer closeStorage(configOrganizer, database)
+
+	log, err := database.GetRunLog(context.Background(), id)
+	if err != nil {
+		return err
+	}
+
+	_, err = os.Stdout.Write(log)
+	return err
+}
@@ -2,36 +2,73 @@ package main
 
 import (
 	"flag"
-	"home-ci-cd/config"
-	"home-ci-cd/db"
 	"home-ci-cd/engine"
+	"home-ci-cd/pkg"
+	"home-ci-cd/server"
 
 	"go.uber.org/zap"
 
 	"context"
+	"errors"
 	"os"
 	"os/signal"
 	"syscall"
+	// Time zones of pipeline schedules on hosts without a zone database
+	_ "time/tzdata"
 )
 
+const (
+	runCommand      = "run"
+	statusCommand   = "status"
+	historyCommand  = "history"
+	logsCommand     = "logs"
+	rollbackCommand = "rollback"
+	validateCommand = "validate"
+)
+
+// commands are CLI subcommands working against the config and database of the daemon.
+// The daemon holds the database lock only for single transactions, so they work next to it.
+// Commands return errors instead of exiting, so their deferred cleanup runs.
+var commands = map[string]func(args []string) error{
+	runCommand:      triggerRun,
+	statusCommand:   printStatus,
+	historyCommand:  printHistory,
+	logsCommand:     printLogs,
+	rollbackCommand: rollback,
+	validateCommand: validateConfig,
+}
+
 func init() {
-	zap.ReplaceGlobals(zap.Must(zap.NewProduction()))
+	zap.ReplaceGlobals(zap.Must(zap.NewProduction(zap.WrapCore(pkg.NewRedactCore))))
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			if err := command(os.Args[2:]); errors.Is(err, errCommandFailed) {
+				os.Exit(1)
+			} else if err != nil {
+				zap.L().Fatal(err.Error())
+			}
+			return
+		}
+	}
+
+	serve()
+}
+
+func serve() {
 	ctx := context.Background()
 
 	var configPath string
 	flag.StringVar(&configPath, "c", "", "path to config file")
 	flag.Parse()
 
-	configOrganizer, err := config.NewOrganizer(configPath)
+	configOrganizer, cfg, database, err := openStorage(configPath, false)
 	if err != nil {
 		zap.L().Fatal(err.Error())
 	}
 
-	database := db.NewBoltDB()
-
 	eng := engine.NewEngine(configOrganizer, database)
 
 	configOrganizer.AddChangeListeners(eng.Reload)
@@ -40,18 +77,34 @@ func main() {
 		zap.L().Fatal(err.Error())
 	}
 
+	var logServer *server.Server
+	if cfg.Server.Listen != "" {
+		logServer = server.NewServer(cfg.Server, database)
+		logServer.Start()
+	}
+
 	shutdownCtx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
 	zap.L().Info("application started")
 
 	<-shutdownCtx.Done()
+	// A second signal terminates the process without waiting for runs.
+	stop()
 	zap.L().Info("shutdown signal received")
 
-	if err = configOrganizer.Close(); err != nil {
+	if err := configOrganizer.Close(); err != nil {
+		zap.L().Error(err.Error())
+	}
+	if logServer != nil {
+		if err := logServer.Shutdown(ctx); err != nil {
+			zap.L().Error(err.Error())
+		}
+	}
+	if err := eng.Shutdown(ctx); err != nil {
 		zap.L().Error(err.Error())
 	}
-	if err = zap.L().Sync(); err != nil {
+	if err := zap.L().Sync(); err != nil {
 		zap.L().Error("failed to sync logger", zap.Error(err))
 	}
 
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"home-ci-cd/engine"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// rollback redeploys a previous successful commit of a branch.
+func rollback(args []string) error {
+	fs := flag.NewFlagSet(rollbackCommand, flag.ExitOnError)
+
+	var configPath, repository, branch, commit string
+	fs.StringVar(&configPath, "c", "", "path to config file")
+	fs.StringVar(&repository, "repo", "", "repository in owner/name form")
+	fs.StringVar(&branch, "branch", "", "branch to roll back")
+	fs.StringVar(&commit, "to", "", "commit to roll back to, the previous successful one when omitted")
+	_ = fs.Parse(args)
+
+	owner, repo, ok := splitRepository(repository)
+	if !ok || branch == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	configOrganizer, _, database, err := openStorage(configPath, false)
+	if err != nil {
+		return err
+	}
+	defer closeStorage(configOrganizer, database)
+
+	eng := engine.NewEngine(configOrganizer, database)
+	if eng == nil {
+		return errors.New("failed to create engine")
+	}
+
+	run, err := eng.Rollback(ctx, owner, repo, branch, commit)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("rolled back %s branch '%s' to commit %s (image %s), run %d\n", repository, branch, run.Commit, run.ImageTag, run.ID)
+	return nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"home-ci-cd/db"
+	"home-ci-cd/engine"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// triggerRun runs the pipeline of a branch once and exits.
+func triggerRun(args []string) error {
+	fs := flag.NewFlagSet(runCommand, flag.ExitOnError)
+
+	var configPath, repository, branch, commit string
+	fs.StringVar(&configPath, "c", "", "path to config file")
+	fs.StringVar(&repository, "repo", "", "repository in owner/name form")
+	fs.StringVar(&branch, "branch", "", "branch to build")
+	fs.StringVar(&commit, "commit", "", "commit to build, the branch head when omitted")
+	_ = fs.Parse(args)
+
+	owner, repo, ok := splitRepository(repository)
+	if !ok || branch == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	configOrganizer, _, database, err := openStorage(configPath, false)
+	if err != nil {
+		return err
+	}
+	defer closeStorage(configOrganizer, database)
+
+	eng := engine.NewEngine(configOrganizer, database)
+	if eng == nil {
+		return errors.New("failed to create engine")
+	}
+
+	run, err := eng.Trigger(ctx, owner, repo, branch, commit)
+	if run.ID == 0 && err != nil {
+		return err
+	}
+
+	fmt.Printf("run %d of %s branch '%s' at commit %s finished with status %s\n", run.ID, repository, branch, shortCommit(run.Commit), run.Status)
+	if run.Status != db.RunStatusSuccess {
+		return errCommandFailed
+	}
+
+	return nil
+}
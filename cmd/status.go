@@ -0,0 +1,56 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"flag"
+	"fmt"
+	"home-ci-cd/db"
+	"maps"
+	"os"
+	"slices"
+	"text/tabwriter"
+)
+
+// printStatus prints the last built commit of every pipeline of every branch of the configured repositories.
+func printStatus(args []string) error {
+	fs := flag.NewFlagSet(statusCommand, flag.ExitOnError)
+
+	var configPath, repository string
+	fs.StringVar(&configPath, "c", "", "path to config file")
+	fs.StringVar(&repository, "repo", "", "show only the repository in owner/name form")
+	_ = fs.Parse(args)
+
+	ctx := context.Background()
+
+	configOrganizer, cfg, database, err := openStorage(configPath, true)
+	if err != nil {
+		return err
+	}
+	defer closeStorage(configOrganizer, database)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "REPOSITORY\tBRANCH\tPIPELINE\tCOMMIT")
+
+	for _, r := range cfg.Repositories {
+		name := r.Owner + "/" + r.Repo
+		if repository != "" && repository != name {
+			continue
+		}
+
+		commits, err := database.ListLastCommits(ctx, r.Owner, r.Repo)
+		if err != nil {
+			return err
+		}
+
+		pipelines := slices.SortedFunc(maps.Keys(commits), func(a, b db.BranchPipeline) int {
+			return cmp.Or(cmp.Compare(a.Branch, b.Branch), cmp.Compare(a.Pipeline, b.Pipeline))
+		})
+
+		for _, p := range pipelines {
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", name, p.Branch, p.Pipeline, commits[p])
+		}
+	}
+
+	return w.Flush()
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"home-ci-cd/config"
+	"os"
+)
+
+// validateConfig checks the config file and prints every problem found.
+func validateConfig(args []string) error {
+	fs := flag.NewFlagSet(validateCommand, flag.ExitOnError)
+
+	var configPath string
+	fs.StringVar(&configPath, "c", "", "path to config file")
+	_ = fs.Parse(args)
+
+	_, err := config.ValidateFile(configPath)
+
+	var validationErr *config.ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		for _, problem := range validationErr.Problems {
+			_, _ = fmt.Fprintln(os.Stderr, problem)
+		}
+		_, _ = fmt.Fprintf(os.Stderr, "config is invalid: %d problem(s)\n", len(validationErr.Problems))
+		return errCommandFailed
+	case err != nil:
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		return errCommandFailed
+	}
+
+	fmt.Println("config is valid")
+	return nil
+}
@@ -1,25 +1,75 @@
 package config
 
-import "gopkg.in/yaml.v3"
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"home-ci-cd/pkg"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
 
 type RepositoryType string
 type CredentialType string
+type HealthProbeType string
+type BranchMatchMode string
+type ProtectedMode string
 
 const (
 	GithubType RepositoryType = "github"
 )
 
 const (
-	CredentialSSHType CredentialType = "ssh"
+	CredentialSSHType   CredentialType = "ssh"
+	CredentialBasicType CredentialType = "basic"
+	CredentialTokenType CredentialType = "token"
+	CredentialAppType   CredentialType = "githubApp"
+)
+
+const (
+	BranchMatchGlob  BranchMatchMode = "glob"
+	BranchMatchRegex BranchMatchMode = "regex"
+)
+
+const (
+	ProtectedAny  ProtectedMode = "any"
+	ProtectedOnly ProtectedMode = "only"
+	ProtectedNone ProtectedMode = "none"
+)
+
+const (
+	HealthProbeHTTPType    HealthProbeType = "http"
+	HealthProbeTCPType     HealthProbeType = "tcp"
+	HealthProbeCommandType HealthProbeType = "command"
 )
 
 type Config struct {
-	Credentials Credential `yaml:"credentials"`
-	Git         Git        `yaml:"git"`
+	// Credentials referenced by name from repositories and pipelines
+	Credentials map[string]Credential `yaml:"credentials"`
+	// Deploy targets referenced by name from pipelines
+	Environments map[string]Environment `yaml:"environments,omitempty"`
+	Git          Git                    `yaml:"git"`
 	// Directory where repositories will be cloned for further processing
 	BufferDirectory string `yaml:"bufferDirectory"`
+	// Path to the database file shared by the daemon and CLI commands
+	Database string `yaml:"database,omitempty"`
+	// Limits on pipeline runs executed at the same time
+	Concurrency Concurrency `yaml:"concurrency,omitempty"`
+	// HTTP server publishing run logs
+	Server Server `yaml:"server,omitempty"`
+	// Messages about runs sent to chats and mailboxes
+	Notifications Notifications `yaml:"notifications,omitempty"`
+	// Time active runs may take to finish on shutdown before they are canceled, 1m when omitted
+	ShutdownTimeout time.Duration `yaml:"shutdownTimeout,omitempty"`
 	// Repositories with automation scripts
 	Repositories []Repository `yaml:"repositories"`
+
+	// Values resolved from environment variables and files
+	secrets []string
 }
 
 type Repository struct {
@@ -28,17 +78,276 @@ type Repository struct {
 	Owner string `yaml:"owner"`
 	// Repository name
 	Repo string `yaml:"repo"`
+	// Name of the token or githubApp credential used to access the repository, git.github.token when empty
+	Credential string `yaml:"credential,omitempty"`
 	// Automation pipelines for branch processing
 	BranchPipelines []BranchPipeline `yaml:"branchPipelines"`
+	// Automation pipelines for open pull requests
+	PullRequestPipelines []PullRequestPipeline `yaml:"pullRequestPipelines,omitempty"`
+	// Automation pipelines for new tags
+	TagPipelines []TagPipeline `yaml:"tagPipelines,omitempty"`
+	// Path of the pipeline file read from the commit being built, disabled when empty
+	PipelineFile string `yaml:"pipelineFile,omitempty"`
+	// Restrictions applied to pipelines from the pipeline file
+	PipelinePolicy PipelinePolicy `yaml:"pipelinePolicy,omitempty"`
+	// Runs of the repository executed at the same time, concurrency.perRepository when omitted
+	MaxConcurrency int `yaml:"maxConcurrency,omitempty"`
+	// Report runs as check runs instead of commit statuses, requires a githubApp credential
+	Checks bool `yaml:"checks,omitempty"`
+	// Commit message markers skipping automatic runs
+	SkipDirectives SkipDirectives `yaml:"skipDirectives,omitempty"`
+}
+
+type SkipDirectives struct {
+	// Markers skipping the whole run, [skip ci] and [ci skip] when omitted
+	Pipeline []string `yaml:"pipeline,omitempty"`
+	// Markers skipping only the deploy stage, [skip deploy] when omitted
+	Deploy []string `yaml:"deploy,omitempty"`
+	// Ignores markers in commit messages
+	Disabled bool `yaml:"disabled,omitempty"`
+}
+
+// PipelineDirectives returns the markers skipping the whole run.
+func (d SkipDirectives) PipelineDirectives() []string {
+	if len(d.Pipeline) == 0 {
+		return []string{"[skip ci]", "[ci skip]"}
+	}
+
+	return d.Pipeline
+}
+
+// DeployDirectives returns the markers skipping the deploy stage.
+func (d SkipDirectives) DeployDirectives() []string {
+	if len(d.Deploy) == 0 {
+		return []string{"[skip deploy]"}
+	}
+
+	return d.Deploy
+}
+
+// Server serves run logs to anyone holding a signed link, such as links in commit statuses,
+// pull request comments and notifications. Logs may contain build output of private repositories,
+// so the listener should only be reachable by people allowed to read them, preferably behind TLS.
+type Server struct {
+	// Address the run log server listens on, e.g. :8080, disabled when empty
+	Listen string `yaml:"listen,omitempty"`
+	// Address the server is reachable at from GitHub users, used in commit status links
+	ExternalURL string `yaml:"externalURL,omitempty"`
+	// Secret signing run log links, required with listen or externalURL; changing it invalidates issued links
+	SigningKey string `yaml:"signingKey,omitempty"`
+}
+
+type Concurrency struct {
+	// Runs of all repositories executed at the same time, 1 when omitted
+	Workers int `yaml:"workers,omitempty"`
+	// Default limit of runs of one repository, only the global limit applies when omitted
+	PerRepository int `yaml:"perRepository,omitempty"`
+	// Default limit of runs of one pipeline, only the repository limit applies when omitted
+	PerPipeline int `yaml:"perPipeline,omitempty"`
+}
+
+type PipelinePolicy struct {
+	// Allows remote commands and health checks in the pipeline file
+	AllowRemoteCommands bool `yaml:"allowRemoteCommands"`
+	// Branch globs the pipeline file may build, any branch when empty
+	AllowedBranches []string `yaml:"allowedBranches,omitempty"`
+	// Credential names the pipeline file may reference
+	AllowedCredentials []string `yaml:"allowedCredentials,omitempty"`
+	// Environment names the pipeline file may deploy to
+	AllowedEnvironments []string `yaml:"allowedEnvironments,omitempty"`
+}
+
+// PipelineForBranch returns the first branch pipeline matching the branch.
+func (r Repository) PipelineForBranch(branch string) (BranchPipeline, bool, error) {
+	for _, pipeline := range r.BranchPipelines {
+		match, err := pipeline.MatchBranch(branch)
+		if err != nil {
+			return BranchPipeline{}, false, err
+		}
+		if match {
+			return pipeline, true, nil
+		}
+	}
+
+	return BranchPipeline{}, false, nil
 }
 
 type BranchPipeline struct {
-	// Branch matching template
+	// Branch matching template, a glob or a regular expression depending on branchMatch
 	Template string `yaml:"template"`
+	// Further templates of branches the pipeline matches
+	Branches []string `yaml:"branches,omitempty"`
+	// Templates of branches excluded from the pipeline, e.g. release/old-*
+	ExcludeBranches []string `yaml:"excludeBranches,omitempty"`
+	// Syntax of branch templates: glob or regex, glob when omitted
+	BranchMatch BranchMatchMode `yaml:"branchMatch,omitempty"`
+	// Branches matched by protection: any, only protected or none protected, any when omitted
+	Protected ProtectedMode `yaml:"protected,omitempty"`
 	// Docker build executable file
 	DockerFilePath string `yaml:"dockerFilePath"`
-	// Commands to run on remote server
+	// Periodic runs of the branch head, built even when the commit was built before unless it is already running or queued
+	Schedule *Schedule `yaml:"schedule,omitempty"`
+	// Globs of files whose changes trigger the pipeline, e.g. services/api/**, any file when empty
+	Paths []string `yaml:"paths,omitempty"`
+	// Globs of files whose changes alone do not trigger the pipeline
+	PathsIgnore []string `yaml:"pathsIgnore,omitempty"`
+	// Names of basic credentials used to pull images from registries during the build
+	RegistryCredentials []string `yaml:"registryCredentials,omitempty"`
+	// Name of the environment the remote commands run in
+	Environment string `yaml:"environment,omitempty"`
+	// Commands to run on every host of the environment
 	RemoteCommands []string `yaml:"remoteCommands"`
+	// Checks performed after remote commands finish
+	HealthCheck *HealthCheck `yaml:"healthCheck,omitempty"`
+	// Runs of the pipeline executed at the same time, concurrency.perPipeline when omitted
+	MaxConcurrency int `yaml:"maxConcurrency,omitempty"`
+	// Context name of the commit status, home-ci-cd/<template> when omitted
+	StatusContext string `yaml:"statusContext,omitempty"`
+	// Builds a commit again on every poll after its run failed, timed out or was rolled back,
+	// otherwise such a commit waits for a new commit or a manual run
+	RetryFailed bool `yaml:"retryFailed,omitempty"`
+	// Cancels the running build of the branch when a newer commit is waiting
+	CancelSuperseded bool `yaml:"cancelSuperseded,omitempty"`
+	// Time limit for the whole run, unlimited when omitted
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+	// Time limits for individual stages of the run
+	StageTimeouts StageTimeouts `yaml:"stageTimeouts,omitempty"`
+
+	// Set for pipelines read from the repository, DockerFilePath is then inside the repository
+	fromRepository bool
+}
+
+// MatchBranch reports whether the branch matches a template of the pipeline and none of its exclusions.
+// Regular expressions must match the whole branch name.
+func (p BranchPipeline) MatchBranch(branch string) (bool, error) {
+	included := false
+	for _, template := range append([]string{p.Template}, p.Branches...) {
+		match, err := p.matchTemplate(template, branch)
+		if err != nil {
+			return false, err
+		}
+		if match {
+			included = true
+			break
+		}
+	}
+	if !included {
+		return false, nil
+	}
+
+	for _, template := range p.ExcludeBranches {
+		match, err := p.matchTemplate(template, branch)
+		if err != nil || match {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+func (p BranchPipeline) matchTemplate(template, branch string) (bool, error) {
+	if p.BranchMatch == BranchMatchRegex {
+		return regexp.MatchString("^(?:"+template+")$", branch)
+	}
+
+	return filepath.Match(template, branch)
+}
+
+// HasPathFilters reports whether the pipeline only runs for changes of some files.
+func (p BranchPipeline) HasPathFilters() bool {
+	return len(p.Paths) > 0 || len(p.PathsIgnore) > 0
+}
+
+// FromRepository reports whether the pipeline was read from the pipeline file of the repository.
+func (p BranchPipeline) FromRepository() bool {
+	return p.fromRepository
+}
+
+type Schedule struct {
+	// Cron expression with minute, hour, day of month, month and day of week, e.g. "0 3 * * *"
+	Cron string `yaml:"cron"`
+	// IANA time zone the expression is evaluated in, e.g. Europe/Berlin, UTC when omitted
+	TimeZone string `yaml:"timeZone,omitempty"`
+}
+
+// CronSchedule parses the cron expression in the time zone of the schedule.
+func (s Schedule) CronSchedule() (pkg.CronSchedule, error) {
+	location := time.UTC
+	if s.TimeZone != "" {
+		var err error
+		if location, err = time.LoadLocation(s.TimeZone); err != nil {
+			return pkg.CronSchedule{}, fmt.Errorf("%w: %q: %w", ErrInvalidTimeZone, s.TimeZone, err)
+		}
+	}
+
+	return pkg.ParseCron(s.Cron, location)
+}
+
+type PullRequestPipeline struct {
+	// Base branch matching template, any base branch when empty
+	Base string `yaml:"base,omitempty"`
+	// Builds pull requests from forks, without registry credentials and remote commands
+	Forks bool `yaml:"forks,omitempty"`
+	// Build settings of the pull request head, the template matches the head branch
+	// and the status context defaults to home-ci-cd/pr/<template>
+	BranchPipeline `yaml:",inline"`
+}
+
+type TagPipeline struct {
+	// Semantic version range of the tags, e.g. ">=1.0.0 <2.0.0", tags need not be versions when empty
+	Versions string `yaml:"versions,omitempty"`
+	// Build settings of the tagged commit, the template matches the tag name
+	// and the status context defaults to home-ci-cd/tag/<template>
+	BranchPipeline `yaml:",inline"`
+}
+
+type StageTimeouts struct {
+	// Downloading repository files, unlimited when omitted
+	Download time.Duration `yaml:"download,omitempty"`
+	// Building the image, unlimited when omitted
+	Build time.Duration `yaml:"build,omitempty"`
+	// Running remote commands and health checks, unlimited when omitted
+	Deploy time.Duration `yaml:"deploy,omitempty"`
+	// Redeploying the previous image after a failed health check or deploy timeout, the deploy timeout or 10m when omitted
+	Rollback time.Duration `yaml:"rollback,omitempty"`
+}
+
+type Environment struct {
+	// Remote servers the commands run on, as host or host:port
+	Hosts []string `yaml:"hosts"`
+	// SSH port of hosts without an explicit port, 22 when omitted
+	Port int `yaml:"port,omitempty"`
+	// Name of the ssh credential used for the hosts
+	Credential string `yaml:"credential"`
+	// Variables exported to remote commands
+	Variables map[string]string `yaml:"variables,omitempty"`
+	// Number of hosts processed at the same time, 1 when omitted
+	Parallelism int `yaml:"parallelism,omitempty"`
+}
+
+type HealthCheck struct {
+	// Number of attempts for every probe
+	Retries int `yaml:"retries"`
+	// Pause between attempts
+	Interval time.Duration `yaml:"interval"`
+	// Time limit for the whole health check
+	Deadline time.Duration `yaml:"deadline"`
+	// Probes that must all pass
+	Probes []HealthProbe `yaml:"probes"`
+}
+
+type HealthProbe struct {
+	Type HealthProbeType `yaml:"type"`
+	// URL requested by the http probe
+	URL string `yaml:"url,omitempty"`
+	// Expected response status of the http probe, 200 when omitted
+	ExpectedStatus int `yaml:"expectedStatus,omitempty"`
+	// Substring expected in the response body of the http probe
+	ExpectedBody string `yaml:"expectedBody,omitempty"`
+	// host:port dialed by the tcp probe
+	Address string `yaml:"address,omitempty"`
+	// Command executed on remote server by the command probe
+	Command string `yaml:"command,omitempty"`
 }
 
 type Git struct {
@@ -49,6 +358,12 @@ type Git struct {
 type Github struct {
 	// GitHub authentication token
 	Token string `yaml:"token"`
+	// API URL of a GitHub Enterprise Server, e.g. https://github.example.com/api/v3/, api.github.com when empty
+	BaseURL string `yaml:"baseURL,omitempty"`
+	// Upload URL of a GitHub Enterprise Server, baseURL when empty
+	UploadURL string `yaml:"uploadURL,omitempty"`
+	// Path to PEM certificates trusted in addition to the system ones
+	CABundle string `yaml:"caBundle,omitempty"`
 }
 
 type Credential struct {
@@ -57,27 +372,112 @@ type Credential struct {
 }
 
 func (c Credential) CredentialSSH() (CredentialSSH, error) {
-	var zero CredentialSSH
+	var cred CredentialSSH
+	err := c.decode(CredentialSSHType, &cred)
+	return cred, err
+}
+
+func (c Credential) CredentialBasic() (CredentialBasic, error) {
+	var cred CredentialBasic
+	err := c.decode(CredentialBasicType, &cred)
+	return cred, err
+}
 
-	if c.Type != CredentialSSHType {
-		return zero, ErrInvalidCredentialType
+func (c Credential) CredentialToken() (CredentialToken, error) {
+	var cred CredentialToken
+	err := c.decode(CredentialTokenType, &cred)
+	return cred, err
+}
+
+func (c Credential) CredentialGithubApp() (CredentialGithubApp, error) {
+	var cred CredentialGithubApp
+	err := c.decode(CredentialAppType, &cred)
+	return cred, err
+}
+
+func (c Credential) decode(credentialType CredentialType, out any) error {
+	if c.Type != credentialType {
+		return ErrInvalidCredentialType
 	}
 
 	b, err := yaml.Marshal(c.Data)
 	if err != nil {
-		return zero, err
-	}
-
-	var cred CredentialSSH
-	if err = yaml.Unmarshal(b, &cred); err != nil {
-		return zero, err
+		return err
 	}
 
-	return cred, nil
+	return yaml.Unmarshal(b, out)
 }
 
 type CredentialSSH struct {
-	User       string `yaml:"user"`
+	User string `yaml:"user"`
+	// Accepted server public keys in authorized_keys format, knownHosts is used when empty
+	HostKeys []string `yaml:"hostKeys,omitempty"`
+	// Path to the known_hosts file used without hostKeys, ~/.ssh/known_hosts when omitted
+	KnownHosts string `yaml:"knownHosts,omitempty"`
 	PrivateKey string `yaml:"privateKey"`
 	Passphrase string `yaml:"passphrase,omitempty"`
 }
+
+type CredentialBasic struct {
+	// Registry server address, e.g. ghcr.io
+	Registry string `yaml:"registry"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+type CredentialToken struct {
+	Token string `yaml:"token"`
+}
+
+type CredentialGithubApp struct {
+	AppID int64 `yaml:"appId"`
+	// RSA private key of the app in PEM format
+	PrivateKey string `yaml:"privateKey"`
+	// Installation used for owners missing in installations, looked up by owner when omitted
+	InstallationID int64 `yaml:"installationId,omitempty"`
+	// Installations by repository owner
+	Installations map[string]int64 `yaml:"installations,omitempty"`
+}
+
+// RSAPrivateKey parses the private key of the app given in PKCS #1 or PKCS #8 form.
+func (c CredentialGithubApp) RSAPrivateKey() (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(c.PrivateKey))
+	if block == nil {
+		return nil, ErrInvalidPrivateKey
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPrivateKey, err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%w: not an RSA key", ErrInvalidPrivateKey)
+	}
+
+	return rsaKey, nil
+}
+
+// Environment returns the environment with the name.
+func (c Config) Environment(name string) (Environment, error) {
+	env, ok := c.Environments[name]
+	if !ok {
+		return Environment{}, fmt.Errorf("%w: %q", ErrEnvironmentNotFound, name)
+	}
+
+	return env, nil
+}
+
+// Credential returns the credential with the name.
+func (c Config) Credential(name string) (Credential, error) {
+	cred, ok := c.Credentials[name]
+	if !ok {
+		return Credential{}, fmt.Errorf("%w: %q", ErrCredentialNotFound, name)
+	}
+
+	return cred, nil
+}
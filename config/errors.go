@@ -4,4 +4,9 @@ import "errors"
 
 var (
 	ErrInvalidCredentialType = errors.New("invalid credential type value")
+	ErrInvalidChannelType    = errors.New("invalid notification channel type value")
+	ErrInvalidPrivateKey     = errors.New("invalid private key")
+	ErrCredentialNotFound    = errors.New("credential not found")
+	ErrEnvironmentNotFound   = errors.New("environment not found")
+	ErrInvalidTimeZone       = errors.New("invalid time zone")
 )
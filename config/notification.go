@@ -0,0 +1,129 @@
+package config
+
+import (
+	"path/filepath"
+	"slices"
+
+	"gopkg.in/yaml.v3"
+)
+
+type NotificationChannelType string
+type NotificationEvent string
+
+const (
+	NotificationTelegramType NotificationChannelType = "telegram"
+	NotificationWebhookType  NotificationChannelType = "webhook"
+	NotificationEmailType    NotificationChannelType = "email"
+)
+
+const (
+	// A run starts executing after waiting for a worker
+	NotificationStarted NotificationEvent = "started"
+	// A run failed, timed out or its deploy was rolled back
+	NotificationFailed NotificationEvent = "failed"
+	// A run succeeded after the previous run of the branch failed
+	NotificationRecovered NotificationEvent = "recovered"
+	// A run succeeded, including recovered runs
+	NotificationSucceeded NotificationEvent = "succeeded"
+)
+
+type Notifications struct {
+	// Destinations of notifications, by name
+	Channels map[string]NotificationChannel `yaml:"channels,omitempty"`
+	// Rules selecting the events sent to channels
+	Rules []NotificationRule `yaml:"rules,omitempty"`
+}
+
+type NotificationChannel struct {
+	Type NotificationChannelType `yaml:"type"`
+	Data any                     `yaml:"data"`
+}
+
+func (c NotificationChannel) Telegram() (NotificationTelegram, error) {
+	var channel NotificationTelegram
+	err := c.decode(NotificationTelegramType, &channel)
+	return channel, err
+}
+
+func (c NotificationChannel) Webhook() (NotificationWebhook, error) {
+	var channel NotificationWebhook
+	err := c.decode(NotificationWebhookType, &channel)
+	return channel, err
+}
+
+func (c NotificationChannel) Email() (NotificationEmail, error) {
+	var channel NotificationEmail
+	err := c.decode(NotificationEmailType, &channel)
+	return channel, err
+}
+
+func (c NotificationChannel) decode(channelType NotificationChannelType, out any) error {
+	if c.Type != channelType {
+		return ErrInvalidChannelType
+	}
+
+	b, err := yaml.Marshal(c.Data)
+	if err != nil {
+		return err
+	}
+
+	return yaml.Unmarshal(b, out)
+}
+
+type NotificationTelegram struct {
+	// Token of the bot sending the messages
+	BotToken string `yaml:"botToken"`
+	// Chat the bot writes to, a numeric ID or @channelname
+	ChatID string `yaml:"chatId"`
+}
+
+type NotificationWebhook struct {
+	// Incoming webhook URL of a Slack or Mattermost channel
+	URL string `yaml:"url"`
+}
+
+type NotificationEmail struct {
+	// SMTP server as host:port, STARTTLS is used when the server offers it
+	Server   string `yaml:"server"`
+	Username string `yaml:"username,omitempty"`
+	Password string `yaml:"password,omitempty"`
+	// Sender address
+	From string `yaml:"from"`
+	// Recipient addresses
+	To []string `yaml:"to"`
+}
+
+type NotificationRule struct {
+	// Names of the channels the events are sent to
+	Channels []string `yaml:"channels"`
+	// Events sent to the channels
+	Events []NotificationEvent `yaml:"events"`
+	// Globs of owner/repo names, any repository when empty
+	Repositories []string `yaml:"repositories,omitempty"`
+	// Templates of the pipelines, any pipeline when empty
+	Pipelines []string `yaml:"pipelines,omitempty"`
+}
+
+// Match reports whether the rule sends the event of a run of the pipeline template in the owner/repo repository.
+func (r NotificationRule) Match(repository, template string, event NotificationEvent) bool {
+	events := slices.Contains(r.Events, event) ||
+		(event == NotificationRecovered && slices.Contains(r.Events, NotificationSucceeded))
+	if !events {
+		return false
+	}
+
+	if len(r.Pipelines) > 0 && !slices.Contains(r.Pipelines, template) {
+		return false
+	}
+
+	if len(r.Repositories) == 0 {
+		return true
+	}
+	for _, pattern := range r.Repositories {
+		if match, _ := filepath.Match(pattern, repository); match {
+			return true
+		}
+	}
+
+	return false
+}
@@ -1,11 +1,11 @@
 package config
 
 import (
+	"home-ci-cd/pkg"
 	"os"
 
 	"github.com/fsnotify/fsnotify"
 	"go.uber.org/zap"
-	"gopkg.in/yaml.v3"
 )
 
 const (
@@ -20,10 +20,7 @@ type Organizer struct {
 }
 
 func NewOrganizer(configPath string) (*Organizer, error) {
-	path := defaultConfigPath
-	if configPath != "" {
-		path = configPath
-	}
+	path := configPathOrDefault(configPath)
 
 	// TODO проверка существования файла
 
@@ -72,10 +69,11 @@ func (o *Organizer) Load() (Config, error) {
 		return cfg, err
 	}
 
-	if err = yaml.Unmarshal(data, &cfg); err != nil {
+	if cfg, err = Parse(data); err != nil {
 		zap.L().Error(err.Error())
-		return o.lastConfig, ErrInvalidConfig
+		return o.lastConfig, err
 	}
+	pkg.AddSecrets(cfg.Secrets()...)
 
 	o.lastConfig = cfg
 
@@ -102,3 +100,11 @@ func (o *Organizer) watch() {
 		}
 	}
 }
+
+func configPathOrDefault(configPath string) string {
+	if configPath == "" {
+		return defaultConfigPath
+	}
+
+	return configPath
+}
@@ -0,0 +1,69 @@
+package config
+
+import (
+	"path/filepath"
+)
+
+// PipelineFile is the pipeline definition stored in a watched repository.
+type PipelineFile struct {
+	// Automation pipelines for branch processing
+	BranchPipelines []BranchPipeline `yaml:"branchPipelines"`
+}
+
+// ParsePipelineFile decodes and validates a pipeline file with the schema of the central config
+// and the restrictions of the policy. Only credentials and environments allowed by the policy may be referenced.
+// Secret references are deliberately not resolved.
+func ParsePipelineFile(data []byte, policy PipelinePolicy, credentials map[string]Credential, environments map[string]Environment) ([]BranchPipeline, error) {
+	var file PipelineFile
+
+	v, err := decodeStrict(data, &file)
+	if err != nil {
+		return nil, err
+	}
+	v.inRepository = true
+	v.credentials = make(map[string]Credential)
+	for _, name := range policy.AllowedCredentials {
+		if cred, ok := credentials[name]; ok {
+			v.credentials[name] = cred
+		}
+	}
+	v.environments = make(map[string]Environment)
+	for _, name := range policy.AllowedEnvironments {
+		if env, ok := environments[name]; ok {
+			v.environments[name] = env
+		}
+	}
+
+	root := path{}
+	for i, pipeline := range file.BranchPipelines {
+		p := root.key("branchPipelines").index(i)
+		v.validateBranchPipeline(p, pipeline)
+
+		if !policy.AllowRemoteCommands && (len(pipeline.RemoteCommands) > 0 || pipeline.HealthCheck != nil) {
+			v.addf(p, "remote commands are not allowed for this repository")
+		}
+
+		file.BranchPipelines[i].fromRepository = true
+	}
+
+	if err = v.err(); err != nil {
+		return nil, err
+	}
+
+	return file.BranchPipelines, nil
+}
+
+// BranchAllowed reports whether pipelines from the pipeline file may build the branch.
+func (p PipelinePolicy) BranchAllowed(branch string) bool {
+	if len(p.AllowedBranches) == 0 {
+		return true
+	}
+
+	for _, pattern := range p.AllowedBranches {
+		if match, err := filepath.Match(pattern, branch); err == nil && match {
+			return true
+		}
+	}
+
+	return false
+}
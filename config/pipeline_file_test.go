@@ -0,0 +1,79 @@
+package config
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestParsePipelineFile(t *testing.T) {
+	t.Setenv("HOME_CI_TEST_SECRET", "secret")
+
+	data := `branchPipelines:
+  - template: main
+    dockerFilePath: deploy/Dockerfile
+    environment: production
+    remoteCommands:
+      - echo ${HOME_CI_TEST_SECRET}
+`
+
+	pipelines, err := ParsePipelineFile([]byte(data), PipelinePolicy{
+		AllowRemoteCommands: true,
+		AllowedEnvironments: []string{"production"},
+	}, nil, map[string]Environment{
+		"production": {Hosts: []string{"app.example.com"}, Credential: "deploy"},
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(pipelines) != 1 || !pipelines[0].FromRepository() {
+		t.Fatalf("expected one repository pipeline, got %+v", pipelines)
+	}
+	if pipelines[0].RemoteCommands[0] != "echo ${HOME_CI_TEST_SECRET}" {
+		t.Fatalf("references must not be resolved in pipeline files, got %q", pipelines[0].RemoteCommands[0])
+	}
+}
+
+func TestParsePipelineFile_PolicyAndSchema(t *testing.T) {
+	data := `branchPipelines:
+  - template: main
+    dockerFilePath: /etc/Dockerfile
+    environment: prod
+    remoteCommands:
+      - docker compose up -d
+  - template: dev
+    dockerFile: Dockerfile
+`
+
+	_, err := ParsePipelineFile([]byte(data), PipelinePolicy{}, nil, map[string]Environment{
+		"prod": {Hosts: []string{"app.example.com"}, Credential: "deploy"},
+	})
+
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("expected ValidationError, got %v", err)
+	}
+
+	lines := make([]int, len(validationErr.Problems))
+	for i, problem := range validationErr.Problems {
+		lines[i] = problem.Line
+	}
+	// remote commands forbidden, absolute dockerfile, environment not allowed, unknown key, missing dockerFilePath
+	if !slices.Equal(lines, []int{2, 3, 4, 7, 8}) {
+		t.Fatalf("unexpected problems: %v", validationErr.Problems)
+	}
+}
+
+func TestPipelinePolicy_BranchAllowed(t *testing.T) {
+	policy := PipelinePolicy{AllowedBranches: []string{"feature/*", "dev"}}
+
+	for branch, want := range map[string]bool{
+		"feature/login": true,
+		"dev":           true,
+		"main":          false,
+	} {
+		if got := policy.BranchAllowed(branch); got != want {
+			t.Fatalf("BranchAllowed(%q) = %v, want %v", branch, got, want)
+		}
+	}
+}
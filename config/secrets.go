@@ -0,0 +1,137 @@
+package config
+
+import (
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+const (
+	// envReferencePrefix marks a value taken from the named environment variable.
+	envReferencePrefix = "env:"
+	// fileReferencePrefix marks a value read from the file at the given path.
+	fileReferencePrefix = "file:"
+)
+
+// envInterpolationRegexp matches ${NAME} placeholders, $${NAME} is an escaped literal ${NAME}.
+var envInterpolationRegexp = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// verbatimFields are yaml keys of commands run on remote hosts. Their ${NAME} placeholders
+// are deploy variables such as ${IMAGE} expanded at deploy time, so they are kept as written.
+var verbatimFields = map[string]bool{
+	"remoteCommands": true,
+	"command":        true,
+}
+
+// Secrets returns values resolved from environment variables and files.
+// They must not appear in logs.
+func (c Config) Secrets() []string {
+	return c.secrets
+}
+
+// resolveReferences replaces env:NAME, file:/path and ${NAME} references in every string of the config
+// except remote commands. Missing references are reported as problems, resolved values are recorded
+// as secrets.
+func (v *validator) resolveReferences(cfg *Config) {
+	v.resolveValue(path{}, reflect.ValueOf(cfg).Elem(), &cfg.secrets)
+}
+
+func (v *validator) resolveValue(p path, rv reflect.Value, secrets *[]string) {
+	switch rv.Kind() {
+	case reflect.String:
+		if resolved, ok := v.resolveString(p, rv.String(), secrets); ok {
+			rv.SetString(resolved)
+		}
+	case reflect.Pointer:
+		if !rv.IsNil() {
+			v.resolveValue(p, rv.Elem(), secrets)
+		}
+	case reflect.Interface:
+		if rv.IsNil() {
+			return
+		}
+		elem := rv.Elem()
+		if elem.Kind() == reflect.String {
+			if resolved, ok := v.resolveString(p, elem.String(), secrets); ok {
+				rv.Set(reflect.ValueOf(resolved))
+			}
+			return
+		}
+		v.resolveValue(p, elem, secrets)
+	case reflect.Struct:
+		t := rv.Type()
+		for i := range t.NumField() {
+			field := t.Field(i)
+			name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+			if !field.IsExported() || name == "-" || verbatimFields[name] {
+				continue
+			}
+			v.resolveValue(p.key(name), rv.Field(i), secrets)
+		}
+	case reflect.Slice:
+		for i := range rv.Len() {
+			v.resolveValue(p.index(i), rv.Index(i), secrets)
+		}
+	case reflect.Map:
+		iter := rv.MapRange()
+		for iter.Next() {
+			key, ok := iter.Key().Interface().(string)
+			if !ok {
+				continue
+			}
+			value := reflect.New(iter.Value().Type()).Elem()
+			value.Set(iter.Value())
+			v.resolveValue(p.key(key), value, secrets)
+			rv.SetMapIndex(iter.Key(), value)
+		}
+	default:
+	}
+}
+
+// resolveString returns the resolved value and whether s contained references.
+// Interpolated variables are secrets too, ${GITHUB_TOKEN} is as common as env:GITHUB_TOKEN.
+func (v *validator) resolveString(p path, s string, secrets *[]string) (string, bool) {
+	switch {
+	case strings.HasPrefix(s, envReferencePrefix):
+		name := strings.TrimPrefix(s, envReferencePrefix)
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			v.addf(p, "environment variable %s is not set", name)
+			return "", false
+		}
+		*secrets = append(*secrets, value)
+		return value, true
+	case strings.HasPrefix(s, fileReferencePrefix):
+		filePath := strings.TrimPrefix(s, fileReferencePrefix)
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			v.addf(p, "cannot read secret file: %v", err)
+			return "", false
+		}
+		value := strings.TrimSuffix(string(data), "\n")
+		*secrets = append(*secrets, value)
+		return value, true
+	}
+
+	if !strings.Contains(s, "${") {
+		return s, false
+	}
+
+	resolved := envInterpolationRegexp.ReplaceAllStringFunc(s, func(match string) string {
+		if strings.HasPrefix(match, "$$") {
+			return match[1:]
+		}
+
+		name := envInterpolationRegexp.FindStringSubmatch(match)[1]
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			v.addf(p, "environment variable %s is not set", name)
+			return match
+		}
+		*secrets = append(*secrets, value)
+		return value
+	})
+
+	return resolved, true
+}
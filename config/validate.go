@@ -0,0 +1,909 @@
+package config
+
+import (
+	"bytes"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"home-ci-cd/pkg"
+	"io"
+	"net"
+	"net/mail"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"gopkg.in/yaml.v3"
+)
+
+// minSigningKeyLength keeps run log link signatures from being brute forced.
+const minSigningKeyLength = 16
+
+var (
+	yamlLineErrorRegexp = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+	shellVariableRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// Problem is a single configuration error located in the YAML source.
+type Problem struct {
+	Line    int
+	Path    string
+	Message string
+}
+
+func (p Problem) String() string {
+	switch {
+	case p.Path == "":
+		return fmt.Sprintf("line %d: %s", p.Line, p.Message)
+	case p.Line == 0:
+		return fmt.Sprintf("%s: %s", p.Path, p.Message)
+	default:
+		return fmt.Sprintf("line %d: %s: %s", p.Line, p.Path, p.Message)
+	}
+}
+
+// ValidationError lists every problem found in the configuration.
+type ValidationError struct {
+	Problems []Problem
+}
+
+func (e *ValidationError) Error() string {
+	lines := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		lines[i] = p.String()
+	}
+
+	return fmt.Sprintf("%s: %d problem(s):\n%s", ErrInvalidConfig, len(e.Problems), strings.Join(lines, "\n"))
+}
+
+func (e *ValidationError) Unwrap() error {
+	return ErrInvalidConfig
+}
+
+// ValidateFile reads and validates the config file without watching it.
+func ValidateFile(configPath string) (Config, error) {
+	data, err := os.ReadFile(configPathOrDefault(configPath))
+	if err != nil {
+		return Config{}, err
+	}
+
+	return Parse(data)
+}
+
+// Parse decodes the config rejecting unknown keys, resolves env:, file: and ${} references
+// and validates every field. All problems are returned at once as a *ValidationError.
+func Parse(data []byte) (Config, error) {
+	var cfg Config
+
+	v, err := decodeStrict(data, &cfg)
+	if err != nil {
+		return cfg, err
+	}
+
+	v.resolveReferences(&cfg)
+	v.validateConfig(cfg)
+
+	return cfg, v.err()
+}
+
+// decodeStrict decodes data into out rejecting unknown keys.
+// Type errors are collected as problems of the returned validator.
+func decodeStrict(data []byte, out any) (*validator, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, &ValidationError{Problems: []Problem{yamlProblem(err.Error())}}
+	}
+
+	v := &validator{root: &root}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(out); err != nil && !errors.Is(err, io.EOF) {
+		var typeErr *yaml.TypeError
+		if !errors.As(err, &typeErr) {
+			return nil, &ValidationError{Problems: []Problem{yamlProblem(err.Error())}}
+		}
+		for _, msg := range typeErr.Errors {
+			v.problems = append(v.problems, yamlProblem(msg))
+		}
+	}
+
+	return v, nil
+}
+
+func yamlProblem(msg string) Problem {
+	m := yamlLineErrorRegexp.FindStringSubmatch(msg)
+	if m == nil {
+		return Problem{Message: strings.TrimPrefix(msg, "yaml: ")}
+	}
+
+	line, _ := strconv.Atoi(m[1])
+	return Problem{Line: line, Message: m[2]}
+}
+
+// path addresses a node of the config, segments are mapping keys or sequence indexes.
+type path []any
+
+func (p path) key(k string) path {
+	return append(slices.Clip(p), k)
+}
+
+func (p path) index(i int) path {
+	return append(slices.Clip(p), i)
+}
+
+func (p path) String() string {
+	var b strings.Builder
+	for _, seg := range p {
+		switch s := seg.(type) {
+		case string:
+			if b.Len() > 0 {
+				b.WriteByte('.')
+			}
+			b.WriteString(s)
+		case int:
+			b.WriteString(fmt.Sprintf("[%d]", s))
+		}
+	}
+
+	return b.String()
+}
+
+type validator struct {
+	root     *yaml.Node
+	problems []Problem
+	// inRepository is set while validating a pipeline file read from a watched repository
+	inRepository bool
+	// credentials that may be referenced by name
+	credentials map[string]Credential
+	// environments that may be referenced by name
+	environments map[string]Environment
+}
+
+func (v *validator) err() error {
+	if len(v.problems) == 0 {
+		return nil
+	}
+
+	slices.SortStableFunc(v.problems, func(a, b Problem) int {
+		return a.Line - b.Line
+	})
+
+	return &ValidationError{Problems: v.problems}
+}
+
+func (v *validator) addf(p path, format string, args ...any) {
+	v.problems = append(v.problems, Problem{
+		Line:    v.line(p),
+		Path:    p.String(),
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// lookup returns the deepest existing node on the path.
+func (v *validator) lookup(p path) *yaml.Node {
+	if len(v.root.Content) == 0 {
+		return v.root
+	}
+
+	node := v.root.Content[0]
+	for _, seg := range p {
+		next := child(node, seg)
+		if next == nil {
+			return node
+		}
+		node = next
+	}
+
+	return node
+}
+
+func (v *validator) line(p path) int {
+	return v.lookup(p).Line
+}
+
+func child(node *yaml.Node, seg any) *yaml.Node {
+	switch s := seg.(type) {
+	case string:
+		if node.Kind != yaml.MappingNode {
+			return nil
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == s {
+				return node.Content[i+1]
+			}
+		}
+	case int:
+		if node.Kind == yaml.SequenceNode && s < len(node.Content) {
+			return node.Content[s]
+		}
+	}
+
+	return nil
+}
+
+func (v *validator) validateConfig(cfg Config) {
+	root := path{}
+
+	if strings.TrimSpace(cfg.BufferDirectory) == "" {
+		v.addf(root.key("bufferDirectory"), "is required")
+	}
+
+	v.credentials = cfg.Credentials
+	names := make([]string, 0, len(cfg.Credentials))
+	for name := range cfg.Credentials {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		v.validateCredential(root.key("credentials").key(name), cfg.Credentials[name])
+	}
+
+	v.environments = cfg.Environments
+	names = names[:0]
+	for name := range cfg.Environments {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		v.validateEnvironment(root.key("environments").key(name), cfg.Environments[name])
+	}
+
+	v.validateGithub(root.key("git").key("github"), cfg.Git.Github)
+	v.validateServer(root.key("server"), cfg.Server)
+	v.validateConcurrency(root.key("concurrency"), cfg.Concurrency)
+	v.validateNotifications(root.key("notifications"), cfg.Notifications)
+	if cfg.ShutdownTimeout < 0 {
+		v.addf(root.key("shutdownTimeout"), "must not be negative")
+	}
+
+	if len(cfg.Repositories) == 0 {
+		v.addf(root.key("repositories"), "at least one repository is required")
+	}
+
+	seen := make(map[string]bool)
+	for i, r := range cfg.Repositories {
+		p := root.key("repositories").index(i)
+		v.validateRepository(p, r)
+
+		name := r.Owner + "/" + r.Repo
+		if seen[name] {
+			v.addf(p, "repository %s is configured more than once", name)
+		}
+		seen[name] = true
+	}
+}
+
+func (v *validator) validateGithub(p path, g Github) {
+	if g.UploadURL != "" && g.BaseURL == "" {
+		v.addf(p.key("uploadURL"), "requires baseURL")
+	}
+	for key, value := range map[string]string{"baseURL": g.BaseURL, "uploadURL": g.UploadURL} {
+		if value == "" {
+			continue
+		}
+		if !validHTTPURL(value) {
+			v.addf(p.key(key), "invalid URL %q, expected http or https URL", value)
+		}
+	}
+
+	if g.CABundle != "" {
+		bundle, err := os.ReadFile(g.CABundle)
+		if err != nil {
+			v.addf(p.key("caBundle"), "cannot read CA bundle: %v", err)
+		} else if !x509.NewCertPool().AppendCertsFromPEM(bundle) {
+			v.addf(p.key("caBundle"), "no PEM certificates found")
+		}
+	}
+}
+
+func (v *validator) validateServer(p path, s Server) {
+	if s.Listen != "" {
+		if _, _, err := net.SplitHostPort(s.Listen); err != nil {
+			v.addf(p.key("listen"), "invalid address %q, expected host:port or :port", s.Listen)
+		}
+	}
+	if s.ExternalURL != "" && !validHTTPURL(s.ExternalURL) {
+		v.addf(p.key("externalURL"), "invalid URL %q, expected http or https URL", s.ExternalURL)
+	}
+	if (s.Listen != "" || s.ExternalURL != "") && len(s.SigningKey) < minSigningKeyLength {
+		v.addf(p.key("signingKey"), "must be at least %d characters long to sign run log links", minSigningKeyLength)
+	}
+}
+
+func (v *validator) validateConcurrency(p path, c Concurrency) {
+	if c.Workers < 0 {
+		v.addf(p.key("workers"), "must not be negative")
+	}
+	if c.PerRepository < 0 {
+		v.addf(p.key("perRepository"), "must not be negative")
+	}
+	if c.PerPipeline < 0 {
+		v.addf(p.key("perPipeline"), "must not be negative")
+	}
+}
+
+func (v *validator) validateNotifications(p path, n Notifications) {
+	names := make([]string, 0, len(n.Channels))
+	for name := range n.Channels {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		v.validateNotificationChannel(p.key("channels").key(name), n.Channels[name])
+	}
+
+	for i, rule := range n.Rules {
+		rp := p.key("rules").index(i)
+
+		if len(rule.Channels) == 0 {
+			v.addf(rp.key("channels"), "at least one channel is required")
+		}
+		for j, name := range rule.Channels {
+			if _, ok := n.Channels[name]; !ok {
+				v.addf(rp.key("channels").index(j), "unknown notification channel %q", name)
+			}
+		}
+
+		if len(rule.Events) == 0 {
+			v.addf(rp.key("events"), "at least one event is required")
+		}
+		for j, event := range rule.Events {
+			switch event {
+			case NotificationStarted, NotificationFailed, NotificationRecovered, NotificationSucceeded:
+			default:
+				v.addf(rp.key("events").index(j), "unknown event %q, expected one of %q, %q, %q, %q",
+					event, NotificationStarted, NotificationFailed, NotificationRecovered, NotificationSucceeded)
+			}
+		}
+
+		for j, pattern := range rule.Repositories {
+			if _, err := filepath.Match(pattern, ""); err != nil {
+				v.addf(rp.key("repositories").index(j), "invalid glob %q: %v", pattern, err)
+			}
+		}
+	}
+}
+
+func (v *validator) validateNotificationChannel(p path, channel NotificationChannel) {
+	dp := p.key("data")
+
+	switch channel.Type {
+	case NotificationTelegramType:
+		v.checkKnownKeys(dp, reflect.TypeFor[NotificationTelegram]())
+		telegram, err := channel.Telegram()
+		if err != nil {
+			v.addf(dp, "%v", err)
+			return
+		}
+		if telegram.BotToken == "" {
+			v.addf(dp.key("botToken"), "is required")
+		}
+		if telegram.ChatID == "" {
+			v.addf(dp.key("chatId"), "is required")
+		}
+	case NotificationWebhookType:
+		v.checkKnownKeys(dp, reflect.TypeFor[NotificationWebhook]())
+		webhook, err := channel.Webhook()
+		if err != nil {
+			v.addf(dp, "%v", err)
+			return
+		}
+		if !validHTTPURL(webhook.URL) {
+			v.addf(dp.key("url"), "invalid URL %q, expected http or https URL", webhook.URL)
+		}
+	case NotificationEmailType:
+		v.checkKnownKeys(dp, reflect.TypeFor[NotificationEmail]())
+		v.validateNotificationEmail(dp, channel)
+	default:
+		v.addf(p.key("type"), "unknown notification channel type %q, expected one of %q, %q, %q",
+			channel.Type, NotificationTelegramType, NotificationWebhookType, NotificationEmailType)
+	}
+}
+
+func (v *validator) validateNotificationEmail(dp path, channel NotificationChannel) {
+	email, err := channel.Email()
+	if err != nil {
+		v.addf(dp, "%v", err)
+		return
+	}
+
+	if host, _, err := net.SplitHostPort(email.Server); err != nil || host == "" {
+		v.addf(dp.key("server"), "invalid address %q, expected host:port", email.Server)
+	}
+	if email.Password != "" && email.Username == "" {
+		v.addf(dp.key("username"), "is required by password")
+	}
+	if _, err = mail.ParseAddress(email.From); err != nil {
+		v.addf(dp.key("from"), "invalid address %q: %v", email.From, err)
+	}
+	if len(email.To) == 0 {
+		v.addf(dp.key("to"), "at least one recipient is required")
+	}
+	for i, to := range email.To {
+		if _, err = mail.ParseAddress(to); err != nil {
+			v.addf(dp.key("to").index(i), "invalid address %q: %v", to, err)
+		}
+	}
+}
+
+func (v *validator) validateCredential(p path, cred Credential) {
+	dp := p.key("data")
+
+	switch cred.Type {
+	case CredentialSSHType:
+		v.checkKnownKeys(dp, reflect.TypeFor[CredentialSSH]())
+		v.validateCredentialSSH(dp, cred)
+	case CredentialBasicType:
+		v.checkKnownKeys(dp, reflect.TypeFor[CredentialBasic]())
+		basicCred, err := cred.CredentialBasic()
+		if err != nil {
+			v.addf(dp, "%v", err)
+			return
+		}
+		if basicCred.Registry == "" {
+			v.addf(dp.key("registry"), "is required")
+		}
+		if basicCred.Username == "" {
+			v.addf(dp.key("username"), "is required")
+		}
+	case CredentialTokenType:
+		v.checkKnownKeys(dp, reflect.TypeFor[CredentialToken]())
+		tokenCred, err := cred.CredentialToken()
+		if err != nil {
+			v.addf(dp, "%v", err)
+			return
+		}
+		if tokenCred.Token == "" {
+			v.addf(dp.key("token"), "is required")
+		}
+	case CredentialAppType:
+		v.checkKnownKeys(dp, reflect.TypeFor[CredentialGithubApp]())
+		v.validateCredentialGithubApp(dp, cred)
+	default:
+		v.addf(p.key("type"), "unknown credential type %q, expected one of %q, %q, %q, %q",
+			cred.Type, CredentialSSHType, CredentialBasicType, CredentialTokenType, CredentialAppType)
+	}
+}
+
+func (v *validator) validateCredentialGithubApp(dp path, cred Credential) {
+	appCred, err := cred.CredentialGithubApp()
+	if err != nil {
+		v.addf(dp, "%v", err)
+		return
+	}
+
+	if appCred.AppID <= 0 {
+		v.addf(dp.key("appId"), "is required")
+	}
+	if appCred.PrivateKey == "" {
+		v.addf(dp.key("privateKey"), "is required")
+	} else if _, err = appCred.RSAPrivateKey(); err != nil {
+		v.addf(dp.key("privateKey"), "malformed app private key: %v", err)
+	}
+	if appCred.InstallationID < 0 {
+		v.addf(dp.key("installationId"), "must not be negative")
+	}
+	for owner, id := range appCred.Installations {
+		if id <= 0 {
+			v.addf(dp.key("installations").key(owner), "must be a positive installation ID")
+		}
+	}
+}
+
+func (v *validator) validateCredentialSSH(dp path, cred Credential) {
+	sshCred, err := cred.CredentialSSH()
+	if err != nil {
+		v.addf(dp, "%v", err)
+		return
+	}
+
+	if sshCred.User == "" {
+		v.addf(dp.key("user"), "is required")
+	}
+
+	if sshCred.PrivateKey == "" {
+		v.addf(dp.key("privateKey"), "is required")
+	} else {
+		if sshCred.Passphrase != "" {
+			_, err = ssh.ParsePrivateKeyWithPassphrase([]byte(sshCred.PrivateKey), []byte(sshCred.Passphrase))
+		} else {
+			_, err = ssh.ParsePrivateKey([]byte(sshCred.PrivateKey))
+		}
+		if err != nil {
+			v.addf(dp.key("privateKey"), "malformed ssh private key: %v", err)
+		}
+	}
+
+	for i, hostKey := range sshCred.HostKeys {
+		if _, _, _, _, err = ssh.ParseAuthorizedKey([]byte(hostKey)); err != nil {
+			v.addf(dp.key("hostKeys").index(i), "malformed ssh host key: %v", err)
+		}
+	}
+	if sshCred.KnownHosts != "" {
+		if _, err = knownhosts.New(sshCred.KnownHosts); err != nil {
+			v.addf(dp.key("knownHosts"), "cannot read known_hosts file: %v", err)
+		}
+	}
+}
+
+func (v *validator) validateEnvironment(p path, env Environment) {
+	if len(env.Hosts) == 0 {
+		v.addf(p.key("hosts"), "at least one host is required")
+	}
+	for i, host := range env.Hosts {
+		if !validHost(host) {
+			v.addf(p.key("hosts").index(i), "invalid host %q, expected host or host:port", host)
+		}
+	}
+
+	if env.Port < 0 || env.Port > 65535 {
+		v.addf(p.key("port"), "must be between 1 and 65535")
+	}
+	if env.Parallelism < 0 {
+		v.addf(p.key("parallelism"), "must not be negative")
+	}
+
+	if env.Credential == "" {
+		v.addf(p.key("credential"), "is required")
+	} else {
+		v.validateCredentialRef(p.key("credential"), env.Credential, CredentialSSHType)
+	}
+
+	for name := range env.Variables {
+		if !shellVariableRegexp.MatchString(name) {
+			v.addf(p.key("variables").key(name), "invalid variable name %q", name)
+		}
+	}
+}
+
+func validHTTPURL(value string) bool {
+	u, err := url.Parse(value)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func validHost(host string) bool {
+	if strings.ContainsAny(host, " \t/") || host == "" {
+		return false
+	}
+	if !strings.Contains(host, ":") {
+		return true
+	}
+
+	h, port, err := net.SplitHostPort(host)
+	if err != nil || h == "" {
+		return false
+	}
+	n, err := strconv.Atoi(port)
+	return err == nil && n > 0 && n <= 65535
+}
+
+// validateCredentialRef checks that the named credential exists and has the expected type.
+func (v *validator) validateCredentialRef(p path, name string, credentialTypes ...CredentialType) {
+	cred, ok := v.credentials[name]
+	switch {
+	case !ok && v.inRepository:
+		v.addf(p, "credential %q is not allowed for this repository", name)
+	case !ok:
+		v.addf(p, "unknown credential %q", name)
+	case !slices.Contains(credentialTypes, cred.Type):
+		expected := make([]string, len(credentialTypes))
+		for i, t := range credentialTypes {
+			expected[i] = strconv.Quote(string(t))
+		}
+		v.addf(p, "credential %q has type %q, expected %s", name, cred.Type, strings.Join(expected, " or "))
+	}
+}
+
+// validateEnvironmentRef checks that the named environment exists.
+func (v *validator) validateEnvironmentRef(p path, name string) {
+	_, ok := v.environments[name]
+	switch {
+	case !ok && v.inRepository:
+		v.addf(p, "environment %q is not allowed for this repository", name)
+	case !ok:
+		v.addf(p, "unknown environment %q", name)
+	}
+}
+
+func (v *validator) validateRepository(p path, r Repository) {
+	switch r.Type {
+	case GithubType:
+	case "":
+		v.addf(p.key("type"), "is required")
+	default:
+		v.addf(p.key("type"), "unknown repository type %q, expected %q", r.Type, GithubType)
+	}
+
+	if r.Owner == "" {
+		v.addf(p.key("owner"), "is required")
+	}
+	if r.Repo == "" {
+		v.addf(p.key("repo"), "is required")
+	}
+	if r.Credential != "" {
+		v.validateCredentialRef(p.key("credential"), r.Credential, CredentialTokenType, CredentialAppType)
+	}
+	for key, directives := range map[string][]string{"pipeline": r.SkipDirectives.Pipeline, "deploy": r.SkipDirectives.Deploy} {
+		for i, directive := range directives {
+			if strings.TrimSpace(directive) == "" {
+				v.addf(p.key("skipDirectives").key(key).index(i), "directive is empty")
+			}
+		}
+	}
+	if r.Checks {
+		if cred, ok := v.credentials[r.Credential]; !ok || cred.Type != CredentialAppType {
+			v.addf(p.key("checks"), "check runs require a %q credential", CredentialAppType)
+		}
+	}
+	if len(r.BranchPipelines) == 0 && len(r.PullRequestPipelines) == 0 && len(r.TagPipelines) == 0 && r.PipelineFile == "" {
+		v.addf(p.key("branchPipelines"), "at least one pipeline is required")
+	}
+	if r.MaxConcurrency < 0 {
+		v.addf(p.key("maxConcurrency"), "must not be negative")
+	}
+	if r.PipelineFile != "" && !filepath.IsLocal(r.PipelineFile) {
+		v.addf(p.key("pipelineFile"), "must be a relative path inside the repository")
+	}
+	for i, pattern := range r.PipelinePolicy.AllowedBranches {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			v.addf(p.key("pipelinePolicy").key("allowedBranches").index(i), "invalid glob %q: %v", pattern, err)
+		}
+	}
+	for i, name := range r.PipelinePolicy.AllowedCredentials {
+		if _, ok := v.credentials[name]; !ok {
+			v.addf(p.key("pipelinePolicy").key("allowedCredentials").index(i), "unknown credential %q", name)
+		}
+	}
+	for i, name := range r.PipelinePolicy.AllowedEnvironments {
+		if _, ok := v.environments[name]; !ok {
+			v.addf(p.key("pipelinePolicy").key("allowedEnvironments").index(i), "unknown environment %q", name)
+		}
+	}
+
+	for i, pipeline := range r.BranchPipelines {
+		v.validateBranchPipeline(p.key("branchPipelines").index(i), pipeline)
+	}
+	for i, pipeline := range r.PullRequestPipelines {
+		v.validatePullRequestPipeline(p.key("pullRequestPipelines").index(i), pipeline)
+	}
+	for i, pipeline := range r.TagPipelines {
+		v.validateTagPipeline(p.key("tagPipelines").index(i), pipeline)
+	}
+}
+
+func (v *validator) validatePullRequestPipeline(p path, pipeline PullRequestPipeline) {
+	if _, err := filepath.Match(pipeline.Base, ""); err != nil {
+		v.addf(p.key("base"), "invalid glob %q: %v", pipeline.Base, err)
+	}
+	if pipeline.Protected != "" {
+		v.addf(p.key("protected"), "is not supported by pull request pipelines")
+	}
+	if pipeline.Schedule != nil {
+		v.addf(p.key("schedule"), "is not supported by pull request pipelines")
+	}
+
+	v.validateBranchPipeline(p, pipeline.BranchPipeline)
+}
+
+func (v *validator) validateTagPipeline(p path, pipeline TagPipeline) {
+	// A tag has no previous commit to compare with.
+	if pipeline.HasPathFilters() {
+		v.addf(p, "paths and pathsIgnore are not supported by tag pipelines")
+	}
+	if pipeline.Protected != "" {
+		v.addf(p.key("protected"), "is not supported by tag pipelines")
+	}
+	if pipeline.Schedule != nil {
+		v.addf(p.key("schedule"), "is not supported by tag pipelines")
+	}
+	if pipeline.Versions != "" {
+		if _, err := pkg.ParseVersionRange(pipeline.Versions); err != nil {
+			v.addf(p.key("versions"), "%v", err)
+		}
+	}
+
+	v.validateBranchPipeline(p, pipeline.BranchPipeline)
+}
+
+func (v *validator) validateBranchPipeline(p path, pipeline BranchPipeline) {
+	switch pipeline.BranchMatch {
+	case "", BranchMatchGlob, BranchMatchRegex:
+	default:
+		v.addf(p.key("branchMatch"), "unknown branch match %q, expected %q or %q", pipeline.BranchMatch, BranchMatchGlob, BranchMatchRegex)
+	}
+	switch pipeline.Protected {
+	case "", ProtectedAny, ProtectedOnly, ProtectedNone:
+	default:
+		v.addf(p.key("protected"), "unknown protection filter %q, expected one of %q, %q, %q",
+			pipeline.Protected, ProtectedAny, ProtectedOnly, ProtectedNone)
+	}
+
+	if pipeline.Template == "" {
+		v.addf(p.key("template"), "is required")
+	} else {
+		v.validateBranchTemplate(p.key("template"), pipeline.BranchMatch, pipeline.Template)
+	}
+	for i, template := range pipeline.Branches {
+		v.validateBranchTemplate(p.key("branches").index(i), pipeline.BranchMatch, template)
+	}
+	for i, template := range pipeline.ExcludeBranches {
+		v.validateBranchTemplate(p.key("excludeBranches").index(i), pipeline.BranchMatch, template)
+	}
+
+	v.validateDockerfile(p.key("dockerFilePath"), pipeline.DockerFilePath)
+
+	if pipeline.Schedule != nil {
+		_, err := pipeline.Schedule.CronSchedule()
+		switch {
+		case pipeline.Schedule.Cron == "":
+			v.addf(p.key("schedule").key("cron"), "is required")
+		case errors.Is(err, ErrInvalidTimeZone):
+			v.addf(p.key("schedule").key("timeZone"), "%v", err)
+		case err != nil:
+			v.addf(p.key("schedule").key("cron"), "%v", err)
+		}
+	}
+
+	for key, patterns := range map[string][]string{"paths": pipeline.Paths, "pathsIgnore": pipeline.PathsIgnore} {
+		for i, pattern := range patterns {
+			if err := pkg.ValidatePathPattern(pattern); err != nil {
+				v.addf(p.key(key).index(i), "invalid glob %q: %v", pattern, err)
+			}
+		}
+	}
+
+	if pipeline.MaxConcurrency < 0 {
+		v.addf(p.key("maxConcurrency"), "must not be negative")
+	}
+	if pipeline.Timeout < 0 {
+		v.addf(p.key("timeout"), "must not be negative")
+	}
+	if pipeline.StageTimeouts.Download < 0 {
+		v.addf(p.key("stageTimeouts").key("download"), "must not be negative")
+	}
+	if pipeline.StageTimeouts.Build < 0 {
+		v.addf(p.key("stageTimeouts").key("build"), "must not be negative")
+	}
+	if pipeline.StageTimeouts.Deploy < 0 {
+		v.addf(p.key("stageTimeouts").key("deploy"), "must not be negative")
+	}
+	if pipeline.StageTimeouts.Rollback < 0 {
+		v.addf(p.key("stageTimeouts").key("rollback"), "must not be negative")
+	}
+
+	for i, name := range pipeline.RegistryCredentials {
+		v.validateCredentialRef(p.key("registryCredentials").index(i), name, CredentialBasicType)
+	}
+
+	for i, command := range pipeline.RemoteCommands {
+		if strings.TrimSpace(command) == "" {
+			v.addf(p.key("remoteCommands").index(i), "command is empty")
+		}
+	}
+
+	switch {
+	case pipeline.Environment != "":
+		v.validateEnvironmentRef(p.key("environment"), pipeline.Environment)
+	case len(pipeline.RemoteCommands) > 0:
+		v.addf(p.key("environment"), "is required by remote commands")
+	}
+
+	if pipeline.HealthCheck != nil {
+		if len(pipeline.RemoteCommands) == 0 {
+			v.addf(p.key("healthCheck"), "requires remoteCommands")
+		}
+		v.validateHealthCheck(p.key("healthCheck"), *pipeline.HealthCheck)
+	}
+}
+
+func (v *validator) validateBranchTemplate(p path, mode BranchMatchMode, template string) {
+	if mode == BranchMatchRegex {
+		if _, err := regexp.Compile(template); err != nil {
+			v.addf(p, "invalid regular expression %q: %v", template, err)
+		}
+		return
+	}
+
+	if _, err := filepath.Match(template, ""); err != nil {
+		v.addf(p, "invalid glob %q: %v", template, err)
+	}
+}
+
+func (v *validator) validateDockerfile(p path, dockerfilePath string) {
+	if dockerfilePath == "" {
+		v.addf(p, "is required")
+		return
+	}
+
+	// Dockerfiles of repository pipelines are checked when the commit is downloaded.
+	if v.inRepository {
+		if !filepath.IsLocal(dockerfilePath) {
+			v.addf(p, "must be a relative path inside the repository")
+		}
+		return
+	}
+
+	info, err := os.Stat(dockerfilePath)
+	switch {
+	case err != nil:
+		v.addf(p, "dockerfile %q is not accessible: %v", dockerfilePath, err)
+	case info.IsDir():
+		v.addf(p, "dockerfile %q is a directory", dockerfilePath)
+	}
+}
+
+func (v *validator) validateHealthCheck(p path, hc HealthCheck) {
+	if hc.Retries < 0 {
+		v.addf(p.key("retries"), "must not be negative")
+	}
+	if hc.Interval < 0 {
+		v.addf(p.key("interval"), "must not be negative")
+	}
+	if hc.Deadline < 0 {
+		v.addf(p.key("deadline"), "must not be negative")
+	}
+	if len(hc.Probes) == 0 {
+		v.addf(p.key("probes"), "at least one probe is required")
+	}
+
+	for i, probe := range hc.Probes {
+		v.validateHealthProbe(p.key("probes").index(i), probe)
+	}
+}
+
+func (v *validator) validateHealthProbe(p path, probe HealthProbe) {
+	switch probe.Type {
+	case HealthProbeHTTPType:
+		u, err := url.Parse(probe.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			v.addf(p.key("url"), "must be an absolute http or https URL")
+		}
+		if probe.ExpectedStatus != 0 && (probe.ExpectedStatus < 100 || probe.ExpectedStatus > 599) {
+			v.addf(p.key("expectedStatus"), "invalid HTTP status %d", probe.ExpectedStatus)
+		}
+	case HealthProbeTCPType:
+		if _, _, err := net.SplitHostPort(probe.Address); err != nil {
+			v.addf(p.key("address"), "must be in host:port form: %v", err)
+		}
+	case HealthProbeCommandType:
+		if strings.TrimSpace(probe.Command) == "" {
+			v.addf(p.key("command"), "is required")
+		}
+	default:
+		v.addf(p.key("type"), "unknown probe type %q, expected one of %q, %q, %q",
+			probe.Type, HealthProbeHTTPType, HealthProbeTCPType, HealthProbeCommandType)
+	}
+}
+
+// checkKnownKeys reports mapping keys of a free-form node that have no field in t.
+func (v *validator) checkKnownKeys(p path, t reflect.Type) {
+	node := v.lookup(p)
+	if node.Kind != yaml.MappingNode || child(v.lookup(p[:len(p)-1]), p[len(p)-1]) == nil {
+		return
+	}
+
+	known := make(map[string]bool)
+	for i := range t.NumField() {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+		known[name] = true
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key := node.Content[i]
+		if !known[key.Value] {
+			v.problems = append(v.problems, Problem{
+				Line:    key.Line,
+				Path:    p.key(key.Value).String(),
+				Message: fmt.Sprintf("field %s not found in type %s", key.Value, t),
+			})
+		}
+	}
+}
@@ -0,0 +1,443 @@
+package config
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func writeDockerfile(t *testing.T) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "Dockerfile")
+	if err := os.WriteFile(path, []byte("FROM scratch\n"), 0644); err != nil {
+		t.Fatalf("failed to write dockerfile: %v", err)
+	}
+
+	return path
+}
+
+func privateKeyPEM(t *testing.T) string {
+	t.Helper()
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	block, err := ssh.MarshalPrivateKey(key, "")
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+
+	return string(pem.EncodeToMemory(block))
+}
+
+func indent(s, prefix string) string {
+	return prefix + strings.ReplaceAll(strings.TrimSpace(s), "\n", "\n"+prefix)
+}
+
+func TestParse_ValidConfig(t *testing.T) {
+	data := `
+bufferDirectory: /tmp/buffer
+credentials:
+  deploy:
+    type: ssh
+    data:
+      user: deploy
+      privateKey: |
+` + indent(privateKeyPEM(t), "        ") + `
+environments:
+  production:
+    hosts: [app1.example.com, "app2.example.com:2222"]
+    credential: deploy
+    parallelism: 2
+    variables:
+      COMPOSE_PROFILES: production
+notifications:
+  channels:
+    ops:
+      type: telegram
+      data:
+        botToken: "123:abc"
+        chatId: "-100"
+    mail:
+      type: email
+      data:
+        server: smtp.example.com:587
+        from: CI <ci@example.com>
+        to: [ops@example.com]
+  rules:
+    - channels: [ops, mail]
+      events: [failed, recovered]
+      repositories: ["owner/*"]
+repositories:
+  - type: github
+    owner: owner
+    repo: repo
+    branchPipelines:
+      - template: "release/*"
+        dockerFilePath: ` + writeDockerfile(t) + `
+        schedule:
+          cron: "0 3 * * mon-fri"
+          timeZone: Europe/Berlin
+        environment: production
+        remoteCommands:
+          - docker compose up -d
+        healthCheck:
+          interval: 2s
+          probes:
+            - type: tcp
+              address: example.com:80
+    pullRequestPipelines:
+      - base: main
+        template: "feature/*"
+        forks: true
+        dockerFilePath: ` + writeDockerfile(t) + `
+    tagPipelines:
+      - template: "v*"
+        versions: ">=1.0.0 <2.0.0"
+        dockerFilePath: ` + writeDockerfile(t) + `
+`
+
+	cfg, err := Parse([]byte(data))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if pr := cfg.Repositories[0].PullRequestPipelines[0]; pr.Base != "main" || pr.Template != "feature/*" || !pr.Forks {
+		t.Fatalf("unexpected pull request pipeline %+v", pr)
+	}
+	if tag := cfg.Repositories[0].TagPipelines[0]; tag.Versions != ">=1.0.0 <2.0.0" || tag.Template != "v*" {
+		t.Fatalf("unexpected tag pipeline %+v", tag)
+	}
+	if rule := cfg.Notifications.Rules[0]; !rule.Match("owner/repo", "release/*", NotificationFailed) || rule.Match("other/repo", "release/*", NotificationFailed) {
+		t.Fatalf("unexpected notification rule matching %+v", rule)
+	}
+	if _, err = cfg.Repositories[0].BranchPipelines[0].Schedule.CronSchedule(); err != nil {
+		t.Fatalf("unexpected schedule error %v", err)
+	}
+	if cfg.Repositories[0].BranchPipelines[0].HealthCheck.Interval.Seconds() != 2 {
+		t.Fatalf("expected 2s interval, got %v", cfg.Repositories[0].BranchPipelines[0].HealthCheck.Interval)
+	}
+}
+
+func TestParse_ReportsAllProblemsWithLines(t *testing.T) {
+	data := `bufferDirectory: /tmp/buffer
+repositories:
+  - type: gitlab
+    owner: owner
+    repo: repo
+    unknownKey: true
+    branchPipelines:
+      - template: "feature/[a"
+        dockerFilePath: /does/not/exist
+`
+
+	_, err := Parse([]byte(data))
+	if !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("expected ErrInvalidConfig, got %v", err)
+	}
+
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("expected ValidationError, got %T", err)
+	}
+
+	expected := map[int]string{
+		3: "unknown repository type",
+		6: "field unknownKey not found",
+		8: "invalid glob",
+		9: "is not accessible",
+	}
+	if len(validationErr.Problems) != len(expected) {
+		t.Fatalf("expected %d problems, got %v", len(expected), validationErr.Problems)
+	}
+	for _, problem := range validationErr.Problems {
+		want, ok := expected[problem.Line]
+		if !ok || !strings.Contains(problem.Message, want) {
+			t.Fatalf("unexpected problem %q", problem)
+		}
+	}
+}
+
+func TestParse_MalformedCredential(t *testing.T) {
+	data := `bufferDirectory: /tmp/buffer
+credentials:
+  deploy:
+    type: ssh
+    data:
+      user: deploy
+      privateKey: not a key
+environments:
+  production:
+    hosts: ["app.example.com:70000"]
+    credential: deploy
+repositories:
+  - type: github
+    owner: owner
+    repo: repo
+    branchPipelines:
+      - template: main
+        dockerFilePath: ` + writeDockerfile(t) + `
+        environment: production
+        remoteCommands: [uptime]
+`
+
+	_, err := Parse([]byte(data))
+
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("expected ValidationError, got %v", err)
+	}
+	if len(validationErr.Problems) != 2 {
+		t.Fatalf("expected 2 problems, got %v", validationErr.Problems)
+	}
+	if validationErr.Problems[0].Line != 7 || validationErr.Problems[1].Line != 10 {
+		t.Fatalf("unexpected problem lines: %v", validationErr.Problems)
+	}
+}
+
+func TestParse_CredentialReferences(t *testing.T) {
+	data := `bufferDirectory: /tmp/buffer
+credentials:
+  github:
+    type: token
+    data:
+      token: secret
+  registry:
+    type: basic
+    data:
+      registry: ghcr.io
+      username: bot
+      password: secret
+environments:
+  production:
+    hosts: [app.example.com]
+    credential: github
+repositories:
+  - type: github
+    owner: owner
+    repo: repo
+    credential: registry
+    checks: true
+    branchPipelines:
+      - template: main
+        dockerFilePath: ` + writeDockerfile(t) + `
+        registryCredentials: [registry, missing]
+        environment: staging
+        remoteCommands: [uptime]
+`
+
+	_, err := Parse([]byte(data))
+
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("expected ValidationError, got %v", err)
+	}
+
+	expected := map[int]string{
+		16: `credential "github" has type "token", expected "ssh"`,
+		21: `credential "registry" has type "basic", expected "token" or "githubApp"`,
+		22: `check runs require a "githubApp" credential`,
+		26: `unknown credential "missing"`,
+		27: `unknown environment "staging"`,
+	}
+	if len(validationErr.Problems) != len(expected) {
+		t.Fatalf("expected %d problems, got %v", len(expected), validationErr.Problems)
+	}
+	for _, problem := range validationErr.Problems {
+		if expected[problem.Line] != problem.Message {
+			t.Fatalf("unexpected problem %q", problem)
+		}
+	}
+}
+
+func TestBranchPipeline_MatchBranch(t *testing.T) {
+	glob := BranchPipeline{
+		Template:        "release/*",
+		Branches:        []string{"main"},
+		ExcludeBranches: []string{"release/old-*"},
+	}
+	regex := BranchPipeline{
+		Template:        `release/v\d+`,
+		ExcludeBranches: []string{`release/v1\d*`},
+		BranchMatch:     BranchMatchRegex,
+	}
+
+	tests := []struct {
+		pipeline BranchPipeline
+		branch   string
+		want     bool
+	}{
+		{glob, "release/2.0", true},
+		{glob, "main", true},
+		{glob, "release/old-1.0", false},
+		{glob, "feature/login", false},
+		{regex, "release/v2", true},
+		{regex, "release/v12", false},
+		{regex, "release/v2-rc", false},
+	}
+
+	for _, tt := range tests {
+		got, err := tt.pipeline.MatchBranch(tt.branch)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", tt.branch, err)
+		}
+		if got != tt.want {
+			t.Fatalf("MatchBranch(%q) = %v, want %v", tt.branch, got, tt.want)
+		}
+	}
+}
+
+func TestParse_BranchMatching(t *testing.T) {
+	data := `bufferDirectory: /tmp/buffer
+repositories:
+  - type: github
+    owner: owner
+    repo: repo
+    branchPipelines:
+      - template: "release/(v1"
+        branchMatch: regex
+        excludeBranches: ["[old"]
+        protected: sometimes
+        dockerFilePath: ` + writeDockerfile(t) + `
+`
+
+	_, err := Parse([]byte(data))
+
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("expected ValidationError, got %v", err)
+	}
+
+	lines := make([]int, len(validationErr.Problems))
+	for i, problem := range validationErr.Problems {
+		lines[i] = problem.Line
+	}
+	// invalid template regex, invalid exclusion regex, unknown protection filter
+	if !slices.Equal(lines, []int{7, 9, 10}) {
+		t.Fatalf("unexpected problems: %v", validationErr.Problems)
+	}
+}
+
+func TestParse_ServerSigningKey(t *testing.T) {
+	data := `bufferDirectory: /tmp/buffer
+server:
+  listen: ":8080"
+  externalURL: https://ci.example.com
+  signingKey: short
+repositories:
+  - type: github
+    owner: owner
+    repo: repo
+    branchPipelines:
+      - template: main
+        dockerFilePath: ` + writeDockerfile(t) + `
+`
+
+	_, err := Parse([]byte(data))
+
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("expected ValidationError, got %v", err)
+	}
+	if len(validationErr.Problems) != 1 || validationErr.Problems[0].Line != 5 {
+		t.Fatalf("unexpected problems: %v", validationErr.Problems)
+	}
+
+	if _, err = Parse([]byte(strings.Replace(data, "short", "0123456789abcdef", 1))); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+}
+
+func TestParse_Schedule(t *testing.T) {
+	data := `bufferDirectory: /tmp/buffer
+repositories:
+  - type: github
+    owner: owner
+    repo: repo
+    branchPipelines:
+      - template: main
+        dockerFilePath: ` + writeDockerfile(t) + `
+        schedule:
+          cron: "0 25 * * *"
+      - template: develop
+        dockerFilePath: ` + writeDockerfile(t) + `
+        schedule:
+          cron: "@daily"
+          timeZone: Mars/Olympus
+    tagPipelines:
+      - template: "v*"
+        dockerFilePath: ` + writeDockerfile(t) + `
+        schedule:
+          cron: "@weekly"
+`
+
+	_, err := Parse([]byte(data))
+
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("expected ValidationError, got %v", err)
+	}
+
+	lines := make([]int, len(validationErr.Problems))
+	for i, problem := range validationErr.Problems {
+		lines[i] = problem.Line
+	}
+	// invalid hour, unknown time zone, schedule of a tag pipeline
+	if !slices.Equal(lines, []int{10, 15, 20}) {
+		t.Fatalf("unexpected problems: %v", validationErr.Problems)
+	}
+}
+
+func TestParse_Notifications(t *testing.T) {
+	data := `bufferDirectory: /tmp/buffer
+notifications:
+  channels:
+    chat:
+      type: webhook
+      data:
+        url: hooks.example.com/abc
+    mail:
+      type: email
+      data:
+        server: smtp.example.com
+        from: ci@example.com
+    pager:
+      type: pager
+  rules:
+    - channels: [chat, sms]
+      events: [failed, deployed]
+repositories:
+  - type: github
+    owner: owner
+    repo: repo
+    branchPipelines:
+      - template: main
+        dockerFilePath: ` + writeDockerfile(t) + `
+`
+
+	_, err := Parse([]byte(data))
+
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("expected ValidationError, got %v", err)
+	}
+
+	lines := make([]int, len(validationErr.Problems))
+	for i, problem := range validationErr.Problems {
+		lines[i] = problem.Line
+	}
+	// invalid webhook URL, SMTP server without port, no recipients,
+	// unknown channel type, unknown channel of the rule, unknown event
+	if !slices.Equal(lines, []int{7, 11, 11, 14, 16, 17}) {
+		t.Fatalf("unexpected problems: %v", validationErr.Problems)
+	}
+}
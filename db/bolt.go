@@ -1,26 +1,49 @@
 package db
 
 import (
+	"bytes"
 	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"go.etcd.io/bbolt"
-	"go.uber.org/zap"
 )
 
 const (
-	dbFilename       = "hommy.db"
-	keyCommitPattern = "%s.%s.%s"
-	commitBucket     = "commits"
+	DefaultPath = "hommy.db"
+	// Owners and repository names never contain a slash, so keys of one repository
+	// never share the prefix of another, while branch names may contain slashes.
+	keyCommitPattern     = "%s/%s/%s"
+	pipelineKeySeparator = "\x00"
+	commitBucket         = "commits"
+	runBucket            = "runs"
+	logBucket            = "logs"
+	pullBucket           = "pullRequests"
+	tagBucket            = "tags"
+	// lockTimeout limits waiting for the file lock held by another process during its transaction.
+	lockTimeout = time.Second * 5
 )
 
+// BoltDB opens the database file for each transaction and closes it right after, so the file
+// lock is held only while a transaction runs and the CLI can work next to the running daemon.
 type BoltDB struct {
-	db *bbolt.DB
+	path     string
+	readOnly bool
+
+	// mu serializes transactions of this process, which would otherwise wait on each other's file lock.
+	mu     sync.Mutex
+	closed bool
 }
 
-func (b *BoltDB) SaveLastCommit(ctx context.Context, owner, repo, branch, commit string) error {
-	key := commitKey(owner, repo, branch)
-	return b.db.Update(func(tx *bbolt.Tx) error {
+func (b *BoltDB) SaveLastCommit(ctx context.Context, owner, repo, branch, pipeline, commit string) error {
+	key := lastCommitKey(owner, repo, branch, pipeline)
+	return b.update(func(tx *bbolt.Tx) error {
 		bucket, err := tx.CreateBucketIfNotExists([]byte(commitBucket))
 		if err != nil {
 			return err
@@ -29,11 +52,11 @@ func (b *BoltDB) SaveLastCommit(ctx context.Context, owner, repo, branch, commit
 	})
 }
 
-func (b *BoltDB) GetLastCommit(ctx context.Context, owner, repo, branch string) (string, error) {
+func (b *BoltDB) GetLastCommit(ctx context.Context, owner, repo, branch, pipeline string) (string, error) {
 	var commitStr string
 
-	key := commitKey(owner, repo, branch)
-	err := b.db.View(func(tx *bbolt.Tx) error {
+	key := lastCommitKey(owner, repo, branch, pipeline)
+	err := b.view(func(tx *bbolt.Tx) error {
 		bucket := tx.Bucket([]byte(commitBucket))
 		if bucket == nil {
 			return nil
@@ -51,21 +74,289 @@ func (b *BoltDB) GetLastCommit(ctx context.Context, owner, repo, branch string)
 	return commitStr, nil
 }
 
-func NewBoltDB() *BoltDB {
-	db, err := bbolt.Open(dbFilename, 0666, nil)
+func (b *BoltDB) ListLastCommits(ctx context.Context, owner, repo string) (map[BranchPipeline]string, error) {
+	commits := make(map[BranchPipeline]string)
+
+	prefix := commitKey(owner, repo, "")
+	err := b.view(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte(commitBucket))
+		if bucket == nil {
+			return nil
+		}
+
+		c := bucket.Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			branch, pipeline, _ := strings.Cut(string(k[len(prefix):]), pipelineKeySeparator)
+			commits[BranchPipeline{Branch: branch, Pipeline: pipeline}] = string(v)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return commits, nil
+}
+
+func (b *BoltDB) SaveRun(ctx context.Context, run *Run) error {
+	return b.update(func(tx *bbolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte(runBucket))
+		if err != nil {
+			return err
+		}
+
+		if run.ID == 0 {
+			if run.ID, err = bucket.NextSequence(); err != nil {
+				return err
+			}
+		}
+
+		data, err := json.Marshal(run)
+		if err != nil {
+			return err
+		}
+
+		return bucket.Put(runKey(run.ID), data)
+	})
+}
+
+func (b *BoltDB) GetRun(ctx context.Context, id uint64) (Run, error) {
+	var run Run
+
+	err := b.view(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte(runBucket))
+		if bucket == nil {
+			return ErrRunNotFound
+		}
+		val := bucket.Get(runKey(id))
+		if val == nil {
+			return ErrRunNotFound
+		}
+		return json.Unmarshal(val, &run)
+	})
+	if err != nil {
+		return Run{}, err
+	}
+
+	return run, nil
+}
+
+func (b *BoltDB) ListRuns(ctx context.Context, filter RunFilter) ([]Run, error) {
+	var runs []Run
+
+	err := b.view(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte(runBucket))
+		if bucket == nil {
+			return nil
+		}
+
+		c := bucket.Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			var run Run
+			if err := json.Unmarshal(v, &run); err != nil {
+				return err
+			}
+			if !filter.match(run) {
+				continue
+			}
+
+			runs = append(runs, run)
+			if filter.Limit > 0 && len(runs) >= filter.Limit {
+				break
+			}
+		}
+
+		return nil
+	})
 	if err != nil {
-		zap.L().Fatal(err.Error())
+		return nil, err
 	}
 
-	return &BoltDB{
-		db: db,
+	return runs, nil
+}
+
+func (b *BoltDB) GetPullRequest(ctx context.Context, owner, repo string, number int) (PullRequest, error) {
+	pr := PullRequest{Owner: owner, Repo: repo, Number: number}
+
+	key := pullRequestKey(owner, repo, number)
+	err := b.view(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte(pullBucket))
+		if bucket == nil {
+			return nil
+		}
+		val := bucket.Get(key)
+		if val == nil {
+			return nil
+		}
+		return json.Unmarshal(val, &pr)
+	})
+	if err != nil {
+		return PullRequest{}, err
 	}
+
+	return pr, nil
 }
 
+func (b *BoltDB) SavePullRequest(ctx context.Context, pr PullRequest) error {
+	return b.update(func(tx *bbolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte(pullBucket))
+		if err != nil {
+			return err
+		}
+
+		data, err := json.Marshal(pr)
+		if err != nil {
+			return err
+		}
+
+		return bucket.Put(pullRequestKey(pr.Owner, pr.Repo, pr.Number), data)
+	})
+}
+
+func (b *BoltDB) SaveBuiltTag(ctx context.Context, owner, repo, tag, commit string) error {
+	key := commitKey(owner, repo, tag)
+	return b.update(func(tx *bbolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte(tagBucket))
+		if err != nil {
+			return err
+		}
+		return bucket.Put(key, []byte(commit))
+	})
+}
+
+func (b *BoltDB) ListBuiltTags(ctx context.Context, owner, repo string) (map[string]string, error) {
+	tags := make(map[string]string)
+
+	prefix := commitKey(owner, repo, "")
+	err := b.view(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte(tagBucket))
+		if bucket == nil {
+			return nil
+		}
+
+		c := bucket.Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			tags[string(k[len(prefix):])] = string(v)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+}
+
+func (b *BoltDB) SaveRunLog(ctx context.Context, id uint64, log []byte) error {
+	return b.update(func(tx *bbolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte(logBucket))
+		if err != nil {
+			return err
+		}
+		return bucket.Put(runKey(id), log)
+	})
+}
+
+func (b *BoltDB) GetRunLog(ctx context.Context, id uint64) ([]byte, error) {
+	var log []byte
+
+	err := b.view(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte(logBucket))
+		if bucket == nil {
+			return ErrRunNotFound
+		}
+		val := bucket.Get(runKey(id))
+		if val == nil {
+			return ErrRunNotFound
+		}
+		log = bytes.Clone(val)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return log, nil
+}
+
+// NewBoltDB checks that the database file at path can be opened, creating it when missing.
+// With readOnly the file must exist and only reads are allowed. Transactions fail with
+// ErrDatabaseLocked when another process holds a conflicting lock for longer than lockTimeout.
+func NewBoltDB(path string, readOnly bool) (*BoltDB, error) {
+	if path == "" {
+		path = DefaultPath
+	}
+
+	b := &BoltDB{path: path, readOnly: readOnly}
+	if err := b.transaction(readOnly, func(*bbolt.DB) error { return nil }); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// Close makes every later transaction fail, the file itself is closed after each transaction.
 func (b *BoltDB) Close() error {
-	return b.db.Close()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	return nil
+}
+
+func (b *BoltDB) update(fn func(tx *bbolt.Tx) error) error {
+	return b.transaction(b.readOnly, func(db *bbolt.DB) error {
+		return db.Update(fn)
+	})
+}
+
+func (b *BoltDB) view(fn func(tx *bbolt.Tx) error) error {
+	return b.transaction(true, func(db *bbolt.DB) error {
+		return db.View(fn)
+	})
+}
+
+func (b *BoltDB) transaction(readOnly bool, fn func(db *bbolt.DB) error) (err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return bbolt.ErrDatabaseNotOpen
+	}
+
+	db, err := bbolt.Open(b.path, 0666, &bbolt.Options{Timeout: lockTimeout, ReadOnly: readOnly})
+	if errors.Is(err, bbolt.ErrTimeout) {
+		return fmt.Errorf("%w: %s", ErrDatabaseLocked, b.path)
+	}
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := db.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+
+	return fn(db)
 }
 
 func commitKey(owner, repo, branch string) []byte {
 	return []byte(fmt.Sprintf(keyCommitPattern, owner, repo, branch))
 }
+
+// lastCommitKey separates the pipeline from the branch by a character git does not allow in branch names.
+func lastCommitKey(owner, repo, branch, pipeline string) []byte {
+	return commitKey(owner, repo, branch+pipelineKeySeparator+pipeline)
+}
+
+func pullRequestKey(owner, repo string, number int) []byte {
+	return commitKey(owner, repo, strconv.Itoa(number))
+}
+
+func runKey(id uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, id)
+	return key
+}
@@ -0,0 +1,175 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"path/filepath"
+	"testing"
+
+	"go.etcd.io/bbolt"
+)
+
+func newTestBoltDB(t *testing.T) (*BoltDB, string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "test.db")
+	database, err := NewBoltDB(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = database.Close() })
+
+	return database, path
+}
+
+func TestBoltDB_ListLastCommits(t *testing.T) {
+	database, _ := newTestBoltDB(t)
+	ctx := context.Background()
+
+	commits := []struct{ repo, branch, pipeline, commit string }{
+		{"b", "main", "main", "c1"},
+		{"b", "feature/x.y", "main", "c2"},
+		{"b.c", "main", "main", "c3"},
+		{"b.c", "dev", "main", "c4"},
+		{"bc", "main", "main", "c5"},
+		{"b", "main", "docs", "c6"},
+	}
+	for _, c := range commits {
+		if err := database.SaveLastCommit(ctx, "owner", c.repo, c.branch, c.pipeline, c.commit); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		repo string
+		want map[BranchPipeline]string
+	}{
+		{"b", map[BranchPipeline]string{{"main", "main"}: "c1", {"feature/x.y", "main"}: "c2", {"main", "docs"}: "c6"}},
+		{"b.c", map[BranchPipeline]string{{"main", "main"}: "c3", {"dev", "main"}: "c4"}},
+		{"bc", map[BranchPipeline]string{{"main", "main"}: "c5"}},
+		{"missing", map[BranchPipeline]string{}},
+	}
+	for _, tt := range tests {
+		got, err := database.ListLastCommits(ctx, "owner", tt.repo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !maps.Equal(got, tt.want) {
+			t.Errorf("ListLastCommits(%q) = %v, want %v", tt.repo, got, tt.want)
+		}
+	}
+
+	commit, err := database.GetLastCommit(ctx, "owner", "b", "feature/x.y", "main")
+	if err != nil || commit != "c2" {
+		t.Errorf("GetLastCommit() = %q, %v, want c2", commit, err)
+	}
+	commit, err = database.GetLastCommit(ctx, "owner", "b", "main", "docs")
+	if err != nil || commit != "c6" {
+		t.Errorf("GetLastCommit(docs) = %q, %v, want c6", commit, err)
+	}
+}
+
+func TestBoltDB_ListBuiltTags(t *testing.T) {
+	database, _ := newTestBoltDB(t)
+	ctx := context.Background()
+
+	if err := database.SaveBuiltTag(ctx, "owner", "b", "v1.0", "c1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.SaveBuiltTag(ctx, "owner", "b.c", "v2.0", "c2"); err != nil {
+		t.Fatal(err)
+	}
+
+	tags, err := database.ListBuiltTags(ctx, "owner", "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"v1.0": "c1"}; !maps.Equal(tags, want) {
+		t.Errorf("ListBuiltTags() = %v, want %v", tags, want)
+	}
+}
+
+func TestBoltDB_Runs(t *testing.T) {
+	database, _ := newTestBoltDB(t)
+	ctx := context.Background()
+
+	first := &Run{Owner: "owner", Repo: "repo", Branch: "main", Status: RunStatusSuccess}
+	second := &Run{Owner: "owner", Repo: "repo", Branch: "dev", Status: RunStatusFailed}
+	for _, run := range []*Run{first, second} {
+		if err := database.SaveRun(ctx, run); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if first.ID == 0 || second.ID <= first.ID {
+		t.Fatalf("unexpected run ids %d, %d", first.ID, second.ID)
+	}
+
+	runs, err := database.ListRuns(ctx, RunFilter{Owner: "owner", Repo: "repo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 2 || runs[0].ID != second.ID {
+		t.Errorf("ListRuns() = %+v, want newest first", runs)
+	}
+
+	runs, err = database.ListRuns(ctx, RunFilter{Branch: "main"})
+	if err != nil || len(runs) != 1 || runs[0].ID != first.ID {
+		t.Errorf("ListRuns(main) = %+v, %v", runs, err)
+	}
+
+	if _, err = database.GetRun(ctx, 100); !errors.Is(err, ErrRunNotFound) {
+		t.Errorf("GetRun() error = %v, want %v", err, ErrRunNotFound)
+	}
+	if _, err = database.GetRunLog(ctx, first.ID); !errors.Is(err, ErrRunNotFound) {
+		t.Errorf("GetRunLog() error = %v, want %v", err, ErrRunNotFound)
+	}
+
+	if err = database.SaveRunLog(ctx, first.ID, []byte("output")); err != nil {
+		t.Fatal(err)
+	}
+	log, err := database.GetRunLog(ctx, first.ID)
+	if err != nil || string(log) != "output" {
+		t.Errorf("GetRunLog() = %q, %v", log, err)
+	}
+}
+
+func TestBoltDB_ReaderNextToWriter(t *testing.T) {
+	writer, path := newTestBoltDB(t)
+	ctx := context.Background()
+
+	reader, err := NewBoltDB(path, true)
+	if err != nil {
+		t.Fatalf("read-only open next to a writer: %v", err)
+	}
+	defer func() { _ = reader.Close() }()
+
+	if err = writer.SaveLastCommit(ctx, "owner", "repo", "main", "main", "c1"); err != nil {
+		t.Fatalf("write next to a reader: %v", err)
+	}
+	if commit, err := reader.GetLastCommit(ctx, "owner", "repo", "main", "main"); err != nil || commit != "c1" {
+		t.Fatalf("GetLastCommit() = %q, %v, want c1", commit, err)
+	}
+	if err = reader.SaveLastCommit(ctx, "owner", "repo", "main", "main", "c2"); err == nil {
+		t.Fatalf("read-only handle must not write")
+	}
+
+	// Another process holding the lock beyond a transaction.
+	held, err := bbolt.Open(path, 0666, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = reader.GetLastCommit(ctx, "owner", "repo", "main", "main"); !errors.Is(err, ErrDatabaseLocked) {
+		t.Fatalf("read next to a held lock: error = %v, want %v", err, ErrDatabaseLocked)
+	}
+	if err = held.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = writer.SaveLastCommit(ctx, "owner", "repo", "main", "main", "c3"); err == nil {
+		t.Fatalf("write after Close must fail")
+	}
+}
@@ -5,8 +5,32 @@ import (
 	"io"
 )
 
+// BranchPipeline identifies a pipeline template running for a branch.
+type BranchPipeline struct {
+	Branch   string
+	Pipeline string
+}
+
 type DB interface {
 	io.Closer
-	SaveLastCommit(ctx context.Context, owner, repo, branch, commit string) error
-	GetLastCommit(ctx context.Context, owner, repo, branch string) (string, error)
+	// SaveLastCommit records the commit built by the pipeline of the branch. Pipelines of one branch
+	// may filter different paths, so each of them has its own last built commit.
+	SaveLastCommit(ctx context.Context, owner, repo, branch, pipeline, commit string) error
+	GetLastCommit(ctx context.Context, owner, repo, branch, pipeline string) (string, error)
+	// ListLastCommits returns the last built commit of every pipeline of every branch of the repository.
+	ListLastCommits(ctx context.Context, owner, repo string) (map[BranchPipeline]string, error)
+	// SaveRun stores the run, assigning a new ID when run.ID is zero.
+	SaveRun(ctx context.Context, run *Run) error
+	GetRun(ctx context.Context, id uint64) (Run, error)
+	// ListRuns returns runs matching the filter, newest first.
+	ListRuns(ctx context.Context, filter RunFilter) ([]Run, error)
+	// GetPullRequest returns the build state of the pull request, the head is empty when it was never built.
+	GetPullRequest(ctx context.Context, owner, repo string, number int) (PullRequest, error)
+	SavePullRequest(ctx context.Context, pr PullRequest) error
+	// SaveBuiltTag records that the tag was built at the commit.
+	SaveBuiltTag(ctx context.Context, owner, repo, tag, commit string) error
+	// ListBuiltTags returns the commits built tags of the repository point to, by tag.
+	ListBuiltTags(ctx context.Context, owner, repo string) (map[string]string, error)
+	SaveRunLog(ctx context.Context, id uint64, log []byte) error
+	GetRunLog(ctx context.Context, id uint64) ([]byte, error)
 }
@@ -0,0 +1,8 @@
+package db
+
+import "errors"
+
+var (
+	ErrRunNotFound    = errors.New("run not found")
+	ErrDatabaseLocked = errors.New("database is locked by another process")
+)
@@ -0,0 +1,12 @@
+package db
+
+// PullRequest is the build state of a pull request.
+type PullRequest struct {
+	Owner  string `json:"owner"`
+	Repo   string `json:"repo"`
+	Number int    `json:"number"`
+	// Last built head commit
+	Head string `json:"head"`
+	// Comment reporting the result of the last run, zero before the first one
+	CommentID int64 `json:"commentId,omitempty"`
+}
@@ -0,0 +1,81 @@
+package db
+
+import "time"
+
+type RunStatus string
+type RunTrigger string
+
+const (
+	RunStatusPending     RunStatus = "pending"
+	RunStatusRunning     RunStatus = "running"
+	RunStatusSuccess     RunStatus = "success"
+	RunStatusFailed      RunStatus = "failed"
+	RunStatusRolledBack  RunStatus = "rolled_back"
+	RunStatusSuperseded  RunStatus = "superseded"
+	RunStatusInterrupted RunStatus = "interrupted"
+	RunStatusTimedOut    RunStatus = "timed_out"
+	RunStatusSkipped     RunStatus = "skipped"
+)
+
+const (
+	RunTriggerPush        RunTrigger = "push"
+	RunTriggerManual      RunTrigger = "manual"
+	RunTriggerRollback    RunTrigger = "rollback"
+	RunTriggerPullRequest RunTrigger = "pull_request"
+	RunTriggerTag         RunTrigger = "tag"
+	RunTriggerSchedule    RunTrigger = "schedule"
+)
+
+// Run is a single pipeline execution for a commit.
+type Run struct {
+	ID         uint64     `json:"id"`
+	Owner      string     `json:"owner"`
+	Repo       string     `json:"repo"`
+	Branch     string     `json:"branch"`
+	Commit     string     `json:"commit"`
+	ImageTag   string     `json:"imageTag"`
+	Trigger    RunTrigger `json:"trigger"`
+	Status     RunStatus  `json:"status"`
+	Error      string     `json:"error,omitempty"`
+	StartedAt  time.Time  `json:"startedAt"`
+	FinishedAt time.Time  `json:"finishedAt,omitzero"`
+	// Template of the pipeline the run belongs to
+	Pipeline string `json:"pipeline,omitempty"`
+	// Number of the pull request whose head is built, zero for branch runs
+	PullRequest int `json:"pullRequest,omitempty"`
+	// Git tag whose commit is built, empty for branch runs
+	Tag string `json:"tag,omitempty"`
+	// Why the run or its deploy stage was skipped
+	Reason string `json:"reason,omitempty"`
+	// Set when the deploy stage was skipped, the image of the run was never deployed
+	DeploySkipped bool `json:"deploySkipped,omitempty"`
+	// Check run reporting the run on GitHub, zero when checks are disabled
+	CheckRunID int64 `json:"checkRunId,omitempty"`
+	// Commit that was live before a rollback run replaced it
+	RolledBackFrom string `json:"rolledBackFrom,omitempty"`
+}
+
+// RunFilter selects runs by their fields. Empty fields match any value,
+// zero Limit means no limit. Deployed selects only runs whose deploy stage was not skipped.
+type RunFilter struct {
+	Owner    string
+	Repo     string
+	Branch   string
+	Pipeline string
+	Commit   string
+	Status   RunStatus
+	Trigger  RunTrigger
+	Deployed bool
+	Limit    int
+}
+
+func (f RunFilter) match(run Run) bool {
+	return (f.Owner == "" || f.Owner == run.Owner) &&
+		(f.Repo == "" || f.Repo == run.Repo) &&
+		(f.Branch == "" || f.Branch == run.Branch) &&
+		(f.Pipeline == "" || f.Pipeline == run.Pipeline) &&
+		(f.Commit == "" || f.Commit == run.Commit) &&
+		(f.Status == "" || f.Status == run.Status) &&
+		(f.Trigger == "" || f.Trigger == run.Trigger) &&
+		(!f.Deployed || !run.DeploySkipped)
+}
@@ -0,0 +1,259 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"home-ci-cd/config"
+	"home-ci-cd/db"
+	"home-ci-cd/pkg"
+	"io"
+	"maps"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultSSHPort     = 22
+	defaultParallelism = 1
+)
+
+// Variables exported to remote commands.
+const (
+	VarImage      = "IMAGE"
+	VarCommit     = "COMMIT"
+	VarBranch     = "BRANCH"
+	VarRepository = "REPOSITORY"
+	VarHost       = "HOST"
+	VarTag        = "TAG"
+	VarVersion    = "VERSION"
+	VarMajor      = "MAJOR"
+	VarMinor      = "MINOR"
+	VarPatch      = "PATCH"
+)
+
+// Deployer runs the deploy stage of a pipeline in an environment:
+// remote commands on every host followed by health checks.
+type Deployer struct {
+	env     config.Environment
+	targets []target
+	output  io.Writer
+}
+
+type target struct {
+	host     string
+	executor *SSHExecutor
+}
+
+// NewDeployer creates a deployer for the environment writing remote command output
+// and health check results to output. cred is the ssh credential of the environment.
+func NewDeployer(env config.Environment, cred config.Credential, output io.Writer) (*Deployer, error) {
+	sshCred, err := cred.CredentialSSH()
+	if err != nil {
+		zap.L().Error(err.Error())
+		return nil, err
+	}
+
+	port := env.Port
+	if port == 0 {
+		port = defaultSSHPort
+	}
+
+	targets := make([]target, len(env.Hosts))
+	for i, host := range env.Hosts {
+		addr := host
+		if _, _, err = net.SplitHostPort(host); err != nil {
+			addr = net.JoinHostPort(host, strconv.Itoa(port))
+		} else {
+			host, _, _ = net.SplitHostPort(host)
+		}
+
+		targets[i] = target{
+			host:     host,
+			executor: NewSSHExecutor(sshCred, addr, newPrefixWriter(output, "["+host+"] ")),
+		}
+	}
+
+	return &Deployer{
+		env:     env,
+		targets: targets,
+		output:  output,
+	}, nil
+}
+
+// Deploy runs remote commands of the pipeline for the image of the run on every host
+// and checks the service health. A failed health check is reported as ErrHealthCheckFailed.
+func (d *Deployer) Deploy(ctx context.Context, pipeline config.BranchPipeline, run db.Run) error {
+	vars := maps.Clone(d.env.Variables)
+	if vars == nil {
+		vars = make(map[string]string)
+	}
+	maps.Copy(vars, Variables(run))
+
+	err := d.forEachHost(ctx, func(ctx context.Context, t target) error {
+		hostVars := maps.Clone(vars)
+		hostVars[VarHost] = t.host
+		return t.executor.Exec(ctx, pipeline.RemoteCommands, hostVars)
+	})
+	if err != nil {
+		zap.L().Error(err.Error())
+		return err
+	}
+
+	err = CheckHealth(ctx, pipeline.HealthCheck, func(ctx context.Context, command string) error {
+		return d.forEachHost(ctx, func(ctx context.Context, t target) error {
+			return t.executor.Exec(ctx, []string{command}, nil)
+		})
+	})
+	if err != nil {
+		zap.L().Error(err.Error())
+		_, _ = fmt.Fprintf(d.output, "Health check failed: %v\n", err)
+		return fmt.Errorf("%w: %w", ErrHealthCheckFailed, err)
+	}
+	if pipeline.HealthCheck != nil && len(pipeline.HealthCheck.Probes) > 0 {
+		_, _ = fmt.Fprintf(d.output, "Health check passed\n")
+	}
+
+	return nil
+}
+
+// forEachHost calls fn for every host, running at most env.Parallelism calls at the same time.
+// No new hosts are started after the first failure and running calls are canceled.
+func (d *Deployer) forEachHost(ctx context.Context, fn func(ctx context.Context, t target) error) error {
+	parallelism := d.env.Parallelism
+	if parallelism <= 0 {
+		parallelism = defaultParallelism
+	}
+
+	cancelCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+		sem      = make(chan struct{}, parallelism)
+	)
+
+	for _, t := range d.targets {
+		sem <- struct{}{}
+		if cancelCtx.Err() != nil {
+			<-sem
+			break
+		}
+
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			if err := fn(cancelCtx, t); err != nil {
+				once.Do(func() {
+					firstErr = fmt.Errorf("host %s: %w", t.host, err)
+					cancel()
+				})
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+
+	return ctx.Err()
+}
+
+// Variables returns remote command variables describing the run.
+func Variables(run db.Run) map[string]string {
+	vars := map[string]string{
+		VarImage:      run.ImageTag,
+		VarCommit:     run.Commit,
+		VarBranch:     run.Branch,
+		VarRepository: run.Owner + "/" + run.Repo,
+	}
+	maps.Copy(vars, VersionVariables(run.Tag))
+
+	return vars
+}
+
+// VersionVariables returns variables describing the tag, its version parts
+// are only set when the tag is a semantic version.
+func VersionVariables(tag string) map[string]string {
+	if tag == "" {
+		return nil
+	}
+
+	vars := map[string]string{VarTag: tag}
+	if v, err := pkg.ParseVersion(tag); err == nil {
+		vars[VarVersion] = v.String()
+		vars[VarMajor] = strconv.Itoa(v.Major)
+		vars[VarMinor] = strconv.Itoa(v.Minor)
+		vars[VarPatch] = strconv.Itoa(v.Patch)
+	}
+
+	return vars
+}
+
+// LastSuccessfulRun returns the latest successful run matching filter that deployed its image.
+func LastSuccessfulRun(ctx context.Context, database db.DB, filter db.RunFilter) (db.Run, error) {
+	filter.Status = db.RunStatusSuccess
+	filter.Deployed = true
+	filter.Limit = 1
+
+	runs, err := database.ListRuns(ctx, filter)
+	if err != nil {
+		zap.L().Error(err.Error())
+		return db.Run{}, err
+	}
+	if len(runs) == 0 {
+		return db.Run{}, ErrNoPreviousDeployment
+	}
+
+	return runs[0], nil
+}
+
+// prefixWriter starts every line written to w with prefix.
+type prefixWriter struct {
+	mu        sync.Mutex
+	w         io.Writer
+	prefix    string
+	lineStart bool
+}
+
+func newPrefixWriter(w io.Writer, prefix string) *prefixWriter {
+	return &prefixWriter{
+		w:         w,
+		prefix:    prefix,
+		lineStart: true,
+	}
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var out strings.Builder
+	for _, line := range strings.SplitAfter(string(b), "\n") {
+		if line == "" {
+			continue
+		}
+		if p.lineStart {
+			out.WriteString(p.prefix)
+		}
+		out.WriteString(line)
+		p.lineStart = strings.HasSuffix(line, "\n")
+	}
+
+	if _, err := io.WriteString(p.w, out.String()); err != nil {
+		return 0, err
+	}
+
+	return len(b), nil
+}
@@ -0,0 +1,82 @@
+package deploy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"home-ci-cd/config"
+	"home-ci-cd/db"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+func TestDeployer_ForEachHostStopsOnFirstFailure(t *testing.T) {
+	d := &Deployer{
+		env: config.Environment{Parallelism: 1},
+		targets: []target{
+			{host: "app1"},
+			{host: "app2"},
+			{host: "app3"},
+		},
+	}
+
+	errFailed := errors.New("failed")
+	var calls atomic.Int32
+	err := d.forEachHost(context.Background(), func(ctx context.Context, t target) error {
+		calls.Add(1)
+		if t.host == "app2" {
+			return errFailed
+		}
+		return nil
+	})
+
+	if !errors.Is(err, errFailed) {
+		t.Fatalf("expected failure, got %v", err)
+	}
+	if calls.Load() != 2 {
+		t.Fatalf("expected 2 hosts to run, got %d", calls.Load())
+	}
+}
+
+func TestPrefixWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := newPrefixWriter(&buf, "[app] ")
+
+	_, _ = w.Write([]byte("first\nsec"))
+	_, _ = w.Write([]byte("ond\nthird\n"))
+
+	if buf.String() != "[app] first\n[app] second\n[app] third\n" {
+		t.Fatalf("unexpected output %q", buf.String())
+	}
+}
+
+func TestLastSuccessfulRun_SkipsUndeployedRuns(t *testing.T) {
+	database, err := db.NewBoltDB(filepath.Join(t.TempDir(), "test.db"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = database.Close() })
+	ctx := context.Background()
+
+	for _, run := range []db.Run{
+		{Commit: "a1", Status: db.RunStatusSuccess},
+		{Commit: "b2", Status: db.RunStatusSuccess, DeploySkipped: true},
+		{Commit: "c3", Status: db.RunStatusFailed},
+	} {
+		run.Owner, run.Repo, run.Branch, run.Pipeline = "owner", "repo", "main", "main"
+		if err := database.SaveRun(ctx, &run); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	filter := db.RunFilter{Owner: "owner", Repo: "repo", Branch: "main", Pipeline: "main"}
+	run, err := LastSuccessfulRun(ctx, database, filter)
+	if err != nil || run.Commit != "a1" {
+		t.Fatalf("got %q, %v, want a1", run.Commit, err)
+	}
+	filter.Commit = "b2"
+	if _, err = LastSuccessfulRun(ctx, database, filter); !errors.Is(err, ErrNoPreviousDeployment) {
+		t.Fatalf("expected ErrNoPreviousDeployment, got %v", err)
+	}
+}
@@ -0,0 +1,15 @@
+package deploy
+
+import "errors"
+
+var (
+	ErrEmptyHost            = errors.New("remote host is not configured")
+	ErrInvalidPrivateKey    = errors.New("invalid ssh private key")
+	ErrInvalidHostKey       = errors.New("invalid ssh host key")
+	ErrNoHostKeys           = errors.New("ssh host keys are not configured and known_hosts cannot be read")
+	ErrInvalidProbeType     = errors.New("invalid health probe type")
+	ErrUnexpectedStatus     = errors.New("unexpected health probe response status")
+	ErrUnexpectedBody       = errors.New("health probe response body does not contain expected value")
+	ErrNoPreviousDeployment = errors.New("no previous successful deployment to roll back to")
+	ErrHealthCheckFailed    = errors.New("health check failed")
+)
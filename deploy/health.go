@@ -0,0 +1,140 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"home-ci-cd/config"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultHealthRetries  = 3
+	defaultHealthInterval = time.Second * 5
+	defaultHealthDeadline = time.Minute
+	defaultExpectedStatus = http.StatusOK
+	probeBodyLimit        = 1 << 20
+)
+
+// commandFn runs a command probe on remote servers.
+type commandFn = func(ctx context.Context, command string) error
+
+// CheckHealth runs every probe of the health check until it passes or runs out of attempts.
+// Command probes are executed through runCommand.
+func CheckHealth(ctx context.Context, hc *config.HealthCheck, runCommand commandFn) error {
+	if hc == nil || len(hc.Probes) == 0 {
+		return nil
+	}
+
+	retries := hc.Retries
+	if retries <= 0 {
+		retries = defaultHealthRetries
+	}
+	interval := hc.Interval
+	if interval <= 0 {
+		interval = defaultHealthInterval
+	}
+	deadline := hc.Deadline
+	if deadline <= 0 {
+		deadline = defaultHealthDeadline
+	}
+
+	dCtx, cancel := context.WithTimeout(ctx, deadline)
+	defer cancel()
+
+	for _, probe := range hc.Probes {
+		if err := runProbe(dCtx, probe, runCommand, retries, interval); err != nil {
+			zap.L().Error(err.Error())
+			return err
+		}
+	}
+
+	return nil
+}
+
+func runProbe(ctx context.Context, probe config.HealthProbe, runCommand commandFn, retries int, interval time.Duration) error {
+	var err error
+
+	for i := range retries {
+		if i > 0 {
+			zap.L().Warn(fmt.Sprintf("Health probe %s failed: %v, attempt %d", probe.Type, err, i))
+
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("health probe %s: %w (last error: %w)", probe.Type, ctx.Err(), err)
+			case <-time.After(interval):
+			}
+		}
+
+		if err = probeOnce(ctx, probe, runCommand); err == nil {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("health probe %s failed after %d attempts: %w", probe.Type, retries, err)
+}
+
+func probeOnce(ctx context.Context, probe config.HealthProbe, runCommand commandFn) error {
+	switch probe.Type {
+	case config.HealthProbeHTTPType:
+		return probeHTTP(ctx, probe)
+	case config.HealthProbeTCPType:
+		return probeTCP(ctx, probe)
+	case config.HealthProbeCommandType:
+		return runCommand(ctx, probe.Command)
+	default:
+		return ErrInvalidProbeType
+	}
+}
+
+func probeHTTP(ctx context.Context, probe config.HealthProbe) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, probe.URL, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	expectedStatus := probe.ExpectedStatus
+	if expectedStatus == 0 {
+		expectedStatus = defaultExpectedStatus
+	}
+	if resp.StatusCode != expectedStatus {
+		return fmt.Errorf("%w: got %d, want %d", ErrUnexpectedStatus, resp.StatusCode, expectedStatus)
+	}
+
+	if probe.ExpectedBody == "" {
+		return nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, probeBodyLimit))
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(string(body), probe.ExpectedBody) {
+		return ErrUnexpectedBody
+	}
+
+	return nil
+}
+
+func probeTCP(ctx context.Context, probe config.HealthProbe) error {
+	dialer := &net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", probe.Address)
+	if err != nil {
+		return err
+	}
+
+	return conn.Close()
+}
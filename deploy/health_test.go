@@ -0,0 +1,107 @@
+package deploy
+
+import (
+	"context"
+	"errors"
+	"home-ci-cd/config"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCheckHealth_HTTPProbeEventualSuccess(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{"status":"ok"}`))
+	}))
+	defer server.Close()
+
+	hc := &config.HealthCheck{
+		Retries:  3,
+		Interval: time.Millisecond,
+		Probes: []config.HealthProbe{
+			{Type: config.HealthProbeHTTPType, URL: server.URL, ExpectedBody: `"ok"`},
+		},
+	}
+
+	if err := CheckHealth(context.Background(), hc, nil); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if attempts != 3 {
+		t.Fatalf("expected 3 attempts, got %d", attempts)
+	}
+}
+
+func TestCheckHealth_HTTPProbeUnexpectedBody(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("starting"))
+	}))
+	defer server.Close()
+
+	hc := &config.HealthCheck{
+		Retries:  2,
+		Interval: time.Millisecond,
+		Probes: []config.HealthProbe{
+			{Type: config.HealthProbeHTTPType, URL: server.URL, ExpectedBody: "ready"},
+		},
+	}
+
+	err := CheckHealth(context.Background(), hc, nil)
+	if !errors.Is(err, ErrUnexpectedBody) {
+		t.Fatalf("expected ErrUnexpectedBody, got %v", err)
+	}
+}
+
+func TestCheckHealth_TCPProbe(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	addr := listener.Addr().String()
+
+	hc := &config.HealthCheck{
+		Retries:  1,
+		Interval: time.Millisecond,
+		Probes: []config.HealthProbe{
+			{Type: config.HealthProbeTCPType, Address: addr},
+		},
+	}
+
+	if err = CheckHealth(context.Background(), hc, nil); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	_ = listener.Close()
+
+	if err = CheckHealth(context.Background(), hc, nil); err == nil {
+		t.Fatalf("expected an error for closed port")
+	}
+}
+
+func TestCheckHealth_DeadlineExceeded(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	hc := &config.HealthCheck{
+		Retries:  100,
+		Interval: 50 * time.Millisecond,
+		Deadline: 100 * time.Millisecond,
+		Probes: []config.HealthProbe{
+			{Type: config.HealthProbeHTTPType, URL: server.URL},
+		},
+	}
+
+	err := CheckHealth(context.Background(), hc, nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+}
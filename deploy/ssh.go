@@ -0,0 +1,209 @@
+package deploy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"home-ci-cd/config"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// SSHExecutor runs shell commands on a remote server using an ssh credential.
+type SSHExecutor struct {
+	cred   config.CredentialSSH
+	addr   string
+	output io.Writer
+}
+
+// NewSSHExecutor creates an executor for the host:port address writing command output to output.
+func NewSSHExecutor(cred config.CredentialSSH, addr string, output io.Writer) *SSHExecutor {
+	return &SSHExecutor{
+		cred:   cred,
+		addr:   addr,
+		output: output,
+	}
+}
+
+// Exec runs commands one by one over a single connection and stops on the first failure.
+// Every command gets env exported as shell variables.
+func (e *SSHExecutor) Exec(ctx context.Context, commands []string, env map[string]string) error {
+	sshClient, err := e.dial(ctx)
+	if err != nil {
+		zap.L().Error(err.Error())
+		return err
+	}
+	defer func() {
+		if err = sshClient.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+			zap.L().Error(err.Error())
+		}
+	}()
+
+	stop := context.AfterFunc(ctx, func() {
+		_ = sshClient.Close()
+	})
+	defer stop()
+
+	prefix := exportPrefix(env)
+
+	for _, command := range commands {
+		if err = e.run(sshClient, prefix, command); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			zap.L().Error(err.Error())
+			return err
+		}
+	}
+
+	return nil
+}
+
+// run runs the command behind the export prefix. Only the command is echoed and reported,
+// the prefix carries the values of secret variables.
+func (e *SSHExecutor) run(sshClient *ssh.Client, prefix, command string) error {
+	session, err := sshClient.NewSession()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = session.Close()
+	}()
+
+	session.Stdout = e.output
+	session.Stderr = e.output
+
+	zap.L().Info(fmt.Sprintf("Running remote command on '%s'", e.addr))
+	_, _ = fmt.Fprintf(e.output, "$ %s\n", command)
+
+	if err = session.Run(prefix + command); err != nil {
+		return fmt.Errorf("remote command '%s' failed: %w", command, err)
+	}
+
+	return nil
+}
+
+func (e *SSHExecutor) dial(ctx context.Context) (*ssh.Client, error) {
+	if e.addr == "" {
+		return nil, ErrEmptyHost
+	}
+
+	clientConfig, err := e.clientConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := &net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", e.addr)
+	if err != nil {
+		return nil, err
+	}
+
+	c, chans, reqs, err := ssh.NewClientConn(conn, e.addr, clientConfig)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
+func (e *SSHExecutor) clientConfig() (*ssh.ClientConfig, error) {
+	var (
+		signer ssh.Signer
+		err    error
+	)
+	if e.cred.Passphrase != "" {
+		signer, err = ssh.ParsePrivateKeyWithPassphrase([]byte(e.cred.PrivateKey), []byte(e.cred.Passphrase))
+	} else {
+		signer, err = ssh.ParsePrivateKey([]byte(e.cred.PrivateKey))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPrivateKey, err)
+	}
+
+	hostKeyCallback, err := e.hostKeyCallback()
+	if err != nil {
+		return nil, err
+	}
+
+	return &ssh.ClientConfig{
+		User:            e.cred.User,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: hostKeyCallback,
+	}, nil
+}
+
+// hostKeyCallback verifies servers against the configured host keys or, without them,
+// against the known_hosts file. Servers with unknown keys are rejected.
+func (e *SSHExecutor) hostKeyCallback() (ssh.HostKeyCallback, error) {
+	if len(e.cred.HostKeys) > 0 {
+		return hostKeysCallback(e.cred.HostKeys)
+	}
+
+	path := e.cred.KnownHosts
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrNoHostKeys, err)
+		}
+		path = filepath.Join(home, ".ssh", "known_hosts")
+	}
+
+	callback, err := knownhosts.New(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrNoHostKeys, err)
+	}
+
+	return callback, nil
+}
+
+// hostKeysCallback accepts a server presenting any of the keys.
+func hostKeysCallback(hostKeys []string) (ssh.HostKeyCallback, error) {
+	keys := make([]ssh.PublicKey, len(hostKeys))
+	for i, hostKey := range hostKeys {
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(hostKey))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidHostKey, err)
+		}
+		keys[i] = key
+	}
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		for _, k := range keys {
+			if bytes.Equal(k.Marshal(), key.Marshal()) {
+				return nil
+			}
+		}
+		return fmt.Errorf("%w: unknown key of %s", ErrInvalidHostKey, hostname)
+	}, nil
+}
+
+// exportPrefix renders env as shell exports placed in front of a command.
+func exportPrefix(env map[string]string) string {
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	var b strings.Builder
+	for _, k := range keys {
+		b.WriteString(fmt.Sprintf("export %s=%s; ", k, shellQuote(env[k])))
+	}
+
+	return b.String()
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,69 @@
+package deploy
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"home-ci-cd/config"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func hostKey(t *testing.T) ssh.PublicKey {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key
+}
+
+func TestSSHExecutor_HostKeyCallback(t *testing.T) {
+	known, unknown := hostKey(t), hostKey(t)
+	remote := &net.TCPAddr{IP: net.ParseIP("192.0.2.10"), Port: 22}
+
+	knownHosts := filepath.Join(t.TempDir(), "known_hosts")
+	line := knownhosts.Line([]string{"app1.example.com", "192.0.2.10"}, known) + "\n"
+	if err := os.WriteFile(knownHosts, []byte(line), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	fromFile := NewSSHExecutor(config.CredentialSSH{KnownHosts: knownHosts}, "app1.example.com:22", nil)
+	callback, err := fromFile.hostKeyCallback()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err = callback("app1.example.com:22", remote, known); err != nil {
+		t.Fatalf("expected the known key to be accepted, got %v", err)
+	}
+	if err = callback("app1.example.com:22", remote, unknown); err == nil {
+		t.Fatal("expected a changed key to be rejected")
+	}
+	if err = callback("app2.example.com:22", &net.TCPAddr{IP: net.ParseIP("192.0.2.11"), Port: 22}, known); err == nil {
+		t.Fatal("expected an unknown host to be rejected")
+	}
+
+	configured := NewSSHExecutor(config.CredentialSSH{
+		HostKeys: []string{string(ssh.MarshalAuthorizedKey(known))},
+	}, "app1.example.com:22", nil)
+	if callback, err = configured.hostKeyCallback(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err = callback("app1.example.com:22", remote, unknown); !errors.Is(err, ErrInvalidHostKey) {
+		t.Fatalf("expected ErrInvalidHostKey, got %v", err)
+	}
+
+	missing := NewSSHExecutor(config.CredentialSSH{KnownHosts: filepath.Join(t.TempDir(), "missing")}, "app1.example.com:22", nil)
+	if _, err = missing.hostKeyCallback(); !errors.Is(err, ErrNoHostKeys) {
+		t.Fatalf("expected ErrNoHostKeys, got %v", err)
+	}
+}
@@ -2,17 +2,26 @@ package engine
 
 import (
 	"context"
+	"fmt"
 	"home-ci-cd/config"
 	"home-ci-cd/db"
 	"home-ci-cd/repository"
+	"time"
 
 	"go.uber.org/zap"
 )
 
+const (
+	defaultShutdownTimeout = time.Minute
+)
+
 type Engine struct {
 	cfg               config.Config
 	configOrganizer   *config.Organizer
 	repositoryManager *repository.Manager
+	db                db.DB
+	// Stops watching branches, set by Run
+	stopWatch context.CancelFunc
 }
 
 func NewEngine(configOrganizer *config.Organizer, database db.DB) *Engine {
@@ -22,12 +31,17 @@ func NewEngine(configOrganizer *config.Organizer, database db.DB) *Engine {
 		return nil
 	}
 
-	manager := repository.NewManager(cfg.Git, cfg.BufferDirectory, database)
+	manager, err := repository.NewManager(cfg, database)
+	if err != nil {
+		zap.L().Error(err.Error())
+		return nil
+	}
 
 	eng := &Engine{
 		configOrganizer:   configOrganizer,
 		repositoryManager: manager,
 		cfg:               cfg,
+		db:                database,
 	}
 
 	return eng
@@ -45,17 +59,41 @@ func (e *Engine) Reload() {
 	// TODO
 }
 
+// Run starts watching repositories. Watching stops when ctx is done or on Shutdown,
+// started runs keep going until Shutdown.
 func (e *Engine) Run(ctx context.Context) error {
 	if err := e.repositoryManager.Load(ctx, e.cfg.Repositories); err != nil {
 		zap.L().Error(err.Error())
 		return err
 	}
 
+	ctx, e.stopWatch = context.WithCancel(ctx)
 	e.watch(ctx)
 
 	return nil
 }
 
+// Shutdown stops starting new runs and waits for active runs up to the configured
+// shutdown timeout, then cancels them. Unfinished runs are recorded as interrupted
+// and the database is closed.
+func (e *Engine) Shutdown(ctx context.Context) error {
+	if e.stopWatch != nil {
+		e.stopWatch()
+	}
+
+	timeout := e.cfg.ShutdownTimeout
+	if timeout == 0 {
+		timeout = defaultShutdownTimeout
+	}
+	zap.L().Info(fmt.Sprintf("Waiting up to %s for active runs", timeout))
+
+	drainCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	e.repositoryManager.Shutdown(drainCtx)
+
+	return e.db.Close()
+}
+
 func (e *Engine) watch(ctx context.Context) {
 	repositories, err := e.repositoryManager.GetAll()
 	if err != nil {
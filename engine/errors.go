@@ -0,0 +1,7 @@
+package engine
+
+import "errors"
+
+var (
+	ErrNothingToDeploy = errors.New("pipeline has no remote commands")
+)
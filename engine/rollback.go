@@ -0,0 +1,88 @@
+package engine
+
+import (
+	"context"
+	"home-ci-cd/db"
+	"home-ci-cd/deploy"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// Rollback redeploys the image of a previous successful run of the branch without rebuilding it.
+// When commit is empty the latest successful run of a commit other than the live one is used,
+// otherwise the latest successful run of the commit, which may be abbreviated.
+// The rollback is recorded as its own run linking to the replaced commit, earlier runs are not changed.
+// It waits in the lane of the pipeline and reports its status like any other run.
+func (e *Engine) Rollback(ctx context.Context, owner, repo, branch, commit string) (db.Run, error) {
+	r, err := e.loadRepository(ctx, owner, repo)
+	if err != nil {
+		zap.L().Error(err.Error())
+		return db.Run{}, err
+	}
+
+	// The pipeline deploying the branch now, its last built commit is live.
+	current, err := r.Pipeline(ctx, branch, "")
+	if err != nil {
+		zap.L().Error(err.Error())
+		return db.Run{}, err
+	}
+
+	liveCommit, err := e.db.GetLastCommit(ctx, owner, repo, branch, current.Template)
+	if err != nil {
+		zap.L().Error(err.Error())
+		return db.Run{}, err
+	}
+
+	target, err := e.rollbackTarget(ctx, owner, repo, branch, current.Template, commit, liveCommit)
+	if err != nil {
+		zap.L().Error(err.Error())
+		return db.Run{}, err
+	}
+
+	pipeline, err := r.Pipeline(ctx, branch, target.Commit)
+	if err != nil {
+		zap.L().Error(err.Error())
+		return db.Run{}, err
+	}
+	if len(pipeline.RemoteCommands) == 0 {
+		return db.Run{}, ErrNothingToDeploy
+	}
+
+	return r.Rollback(ctx, pipeline, target, liveCommit)
+}
+
+// rollbackTarget returns the latest successful run of the pipeline for the commit, which may be abbreviated.
+// Without a commit, the latest successful run of a commit that is neither live nor was
+// replaced by a later rollback is returned. Runs that skipped the deploy stage are not targets,
+// and the newest run that deployed is live even when a later commit was built.
+func (e *Engine) rollbackTarget(ctx context.Context, owner, repo, branch, pipeline, commit, liveCommit string) (db.Run, error) {
+	runs, err := e.db.ListRuns(ctx, db.RunFilter{
+		Owner:    owner,
+		Repo:     repo,
+		Branch:   branch,
+		Pipeline: pipeline,
+		Status:   db.RunStatusSuccess,
+		Deployed: true,
+	})
+	if err != nil {
+		return db.Run{}, err
+	}
+
+	replaced := make(map[string]bool)
+	for _, run := range runs {
+		if run.RolledBackFrom != "" {
+			replaced[run.RolledBackFrom] = true
+		}
+
+		if commit != "" && strings.HasPrefix(run.Commit, commit) {
+			return run, nil
+		}
+		// The newest run deployed the image on the hosts.
+		if commit == "" && run.Commit != liveCommit && run.Commit != runs[0].Commit && !replaced[run.Commit] {
+			return run, nil
+		}
+	}
+
+	return db.Run{}, deploy.ErrNoPreviousDeployment
+}
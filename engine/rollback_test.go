@@ -0,0 +1,72 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"home-ci-cd/db"
+	"home-ci-cd/deploy"
+	"path/filepath"
+	"testing"
+)
+
+func TestEngine_RollbackTarget(t *testing.T) {
+	database, err := db.NewBoltDB(filepath.Join(t.TempDir(), "test.db"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = database.Close() })
+
+	e := &Engine{db: database}
+	ctx := context.Background()
+
+	for _, run := range []db.Run{
+		{Commit: "aaaa111", ImageTag: "repo:a", Trigger: db.RunTriggerPush, Status: db.RunStatusSuccess},
+		{Commit: "bbbb222", ImageTag: "repo:b", Trigger: db.RunTriggerPush, Status: db.RunStatusSuccess},
+		{Commit: "cccc333", ImageTag: "repo:c", Trigger: db.RunTriggerPush, Status: db.RunStatusFailed},
+		{Commit: "dddd444", ImageTag: "repo:d", Trigger: db.RunTriggerPush, Status: db.RunStatusSuccess},
+		// dddd444 was replaced by bbbb222 with the rollback command.
+		{Commit: "bbbb222", ImageTag: "repo:b", Trigger: db.RunTriggerRollback, Status: db.RunStatusSuccess, RolledBackFrom: "dddd444"},
+		// eeee555 was built, but not deployed.
+		{Commit: "eeee555", ImageTag: "repo:e", Trigger: db.RunTriggerPush, Status: db.RunStatusSuccess, DeploySkipped: true},
+		// Another pipeline of the branch.
+		{Pipeline: "docs", Commit: "ffff666", ImageTag: "docs:f", Trigger: db.RunTriggerPush, Status: db.RunStatusSuccess},
+	} {
+		run.Owner, run.Repo, run.Branch = "owner", "repo", "main"
+		if run.Pipeline == "" {
+			run.Pipeline = "main"
+		}
+		if err := database.SaveRun(ctx, &run); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		commit string
+		live   string
+		want   string
+	}{
+		// The previous commit skips the live one and the replaced one.
+		{"", "bbbb222", "aaaa111"},
+		// bbbb222 deployed by the rollback stays live after eeee555.
+		{"", "eeee555", "aaaa111"},
+		// --to selects the commit by prefix, even a replaced one.
+		{"dddd", "bbbb222", "dddd444"},
+		{"aaaa111", "bbbb222", "aaaa111"},
+	}
+	for _, tt := range tests {
+		target, err := e.rollbackTarget(ctx, "owner", "repo", "main", "main", tt.commit, tt.live)
+		if err != nil {
+			t.Fatalf("commit %q, live %q: unexpected error %v", tt.commit, tt.live, err)
+		}
+		if target.Commit != tt.want {
+			t.Fatalf("commit %q, live %q: got %s, want %s", tt.commit, tt.live, target.Commit, tt.want)
+		}
+	}
+
+	// Failed runs, runs that skipped the deploy and runs of other pipelines are not targets.
+	for _, commit := range []string{"cccc", "eeee", "ffff"} {
+		if _, err := e.rollbackTarget(ctx, "owner", "repo", "main", "main", commit, "bbbb222"); !errors.Is(err, deploy.ErrNoPreviousDeployment) {
+			t.Fatalf("commit %q: expected ErrNoPreviousDeployment, got %v", commit, err)
+		}
+	}
+}
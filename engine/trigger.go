@@ -0,0 +1,41 @@
+package engine
+
+import (
+	"context"
+	"home-ci-cd/config"
+	"home-ci-cd/db"
+	"home-ci-cd/repository"
+
+	"go.uber.org/zap"
+)
+
+// Trigger runs the pipeline of the repository branch once for the commit, or for the branch head
+// when commit is empty.
+func (e *Engine) Trigger(ctx context.Context, owner, repo, branch, commit string) (db.Run, error) {
+	r, err := e.loadRepository(ctx, owner, repo)
+	if err != nil {
+		zap.L().Error(err.Error())
+		return db.Run{}, err
+	}
+
+	return r.Trigger(ctx, branch, commit)
+}
+
+// loadRepository loads only the requested repository.
+func (e *Engine) loadRepository(ctx context.Context, owner, repo string) (repository.Repository, error) {
+	var repositories []config.Repository
+	for _, r := range e.cfg.Repositories {
+		if r.Owner == owner && r.Repo == repo {
+			repositories = append(repositories, r)
+		}
+	}
+	if len(repositories) == 0 {
+		return nil, repository.ErrRepositoryNotFound
+	}
+
+	if err := e.repositoryManager.Load(ctx, repositories); err != nil {
+		return nil, err
+	}
+
+	return e.repositoryManager.Get(owner, repo)
+}
@@ -6,10 +6,12 @@ require (
 	github.com/fsnotify/fsnotify v1.9.0
 	github.com/google/go-github/v81 v81.0.0
 	go.uber.org/zap v1.27.1
+	golang.org/x/crypto v0.46.0
 	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
+	github.com/Azure/go-ansiterm v0.0.0-20250102033503-faa5f7b0171c // indirect
 	github.com/Microsoft/go-winio v0.6.2 // indirect
 	github.com/cespare/xxhash/v2 v2.3.0 // indirect
 	github.com/containerd/errdefs v1.0.0 // indirect
@@ -0,0 +1,105 @@
+package notify
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"home-ci-cd/config"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// email sends messages over SMTP. STARTTLS is used when the server offers it,
+// credentials are only sent over TLS or to a server on localhost.
+type email struct {
+	cfg config.NotificationEmail
+}
+
+func newEmail(cfg config.NotificationEmail) *email {
+	return &email{cfg: cfg}
+}
+
+func (e *email) send(ctx context.Context, msg Message) error {
+	host, _, err := net.SplitHostPort(e.cfg.Server)
+	if err != nil {
+		return err
+	}
+	from, err := mail.ParseAddress(e.cfg.From)
+	if err != nil {
+		return err
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", e.cfg.Server)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		if err = conn.SetDeadline(deadline); err != nil {
+			return err
+		}
+	}
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err = c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if e.cfg.Username != "" {
+		if err = c.Auth(smtp.PlainAuth("", e.cfg.Username, e.cfg.Password, host)); err != nil {
+			return err
+		}
+	}
+
+	if err = c.Mail(from.Address); err != nil {
+		return err
+	}
+	for _, to := range e.cfg.To {
+		addr, err := mail.ParseAddress(to)
+		if err != nil {
+			return err
+		}
+		if err = c.Rcpt(addr.Address); err != nil {
+			return err
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(e.message(msg)); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+
+	return c.Quit()
+}
+
+// message renders the message as a plain text email.
+func (e *email) message(msg Message) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\n", e.cfg.From)
+	fmt.Fprintf(&b, "To: %s\n", strings.Join(e.cfg.To, ", "))
+	fmt.Fprintf(&b, "Subject: %s\n", mime.QEncoding.Encode("utf-8", msg.Subject()))
+	fmt.Fprintf(&b, "Date: %s\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\n\n")
+	b.WriteString(msg.Body())
+
+	return []byte(b.String())
+}
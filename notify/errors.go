@@ -0,0 +1,8 @@
+package notify
+
+import "errors"
+
+var (
+	ErrInvalidEndpoint = errors.New("invalid notification endpoint")
+	ErrRequestFailed   = errors.New("request failed")
+)
@@ -0,0 +1,111 @@
+package notify
+
+import (
+	"fmt"
+	"home-ci-cd/config"
+	"home-ci-cd/pkg"
+	"strings"
+	"time"
+)
+
+const (
+	shortCommitLength = 7
+	// Runes of the error kept in messages
+	maxErrorSummary = 300
+)
+
+// Message describes an event of a run.
+type Message struct {
+	Event config.NotificationEvent
+	// Repository as owner/repo
+	Repository string
+	// Template of the pipeline of the run
+	Pipeline string
+	RunID    uint64
+	Branch   string
+	Commit   string
+	// Name of the commit author, omitted when unknown
+	Author string
+	// Time the run took, omitted for started runs
+	Duration time.Duration
+	// Error of a failed run, only its first line is sent
+	Error string
+	// Link to the run log, omitted when empty
+	URL string
+}
+
+// Subject is the one line summary of the event.
+func (m Message) Subject() string {
+	icon := "✅"
+	switch m.Event {
+	case config.NotificationStarted:
+		icon = "▶️"
+	case config.NotificationFailed:
+		icon = "❌"
+	}
+
+	return fmt.Sprintf("%s Run %d of %s %s", icon, m.RunID, m.Repository, m.Event)
+}
+
+// Body lists the details of the run, one per line.
+func (m Message) Body() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Pipeline: %s\n", m.Pipeline)
+	fmt.Fprintf(&b, "Branch: %s\n", m.Branch)
+	if m.Author != "" {
+		fmt.Fprintf(&b, "Commit: %s by %s\n", shortCommit(m.Commit), m.Author)
+	} else {
+		fmt.Fprintf(&b, "Commit: %s\n", shortCommit(m.Commit))
+	}
+	if m.Duration > 0 {
+		fmt.Fprintf(&b, "Duration: %s\n", m.Duration.Round(time.Second))
+	}
+	if m.Error != "" {
+		fmt.Fprintf(&b, "Error: %s\n", errorSummary(m.Error))
+	}
+	if m.URL != "" {
+		fmt.Fprintf(&b, "Log: %s\n", m.URL)
+	}
+
+	return b.String()
+}
+
+// Text is the subject followed by the body.
+func (m Message) Text() string {
+	return m.Subject() + "\n" + m.Body()
+}
+
+// redacted returns the message with registered secrets removed from its text fields.
+// The error is redacted before errorSummary shortens it, so no part of a secret is left.
+func (m Message) redacted() Message {
+	m.Repository = pkg.Redact(m.Repository)
+	m.Pipeline = pkg.Redact(m.Pipeline)
+	m.Branch = pkg.Redact(m.Branch)
+	m.Author = pkg.Redact(m.Author)
+	m.Error = pkg.Redact(m.Error)
+	m.URL = pkg.Redact(m.URL)
+
+	return m
+}
+
+func shortCommit(commit string) string {
+	if len(commit) > shortCommitLength {
+		return commit[:shortCommitLength]
+	}
+
+	return commit
+}
+
+// errorSummary returns the first line of the error, shortened to maxErrorSummary runes.
+func errorSummary(err string) string {
+	line, _, more := strings.Cut(strings.TrimSpace(err), "\n")
+	runes := []rune(line)
+	if len(runes) > maxErrorSummary {
+		return string(runes[:maxErrorSummary]) + "…"
+	}
+	if more {
+		return line + " …"
+	}
+
+	return line
+}
@@ -0,0 +1,185 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"home-ci-cd/config"
+	"home-ci-cd/pkg"
+	"io"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// Time limit of one delivery attempt
+	sendTimeout = time.Second * 30
+	// Bytes of an error response kept in the error
+	maxErrorBody = 512
+)
+
+// channel delivers messages to one destination.
+type channel interface {
+	send(ctx context.Context, msg Message) error
+}
+
+// Notifier sends events of runs to the channels of the rules matching them.
+// A nil Notifier sends nothing.
+type Notifier struct {
+	channels map[string]channel
+	rules    []config.NotificationRule
+}
+
+func NewNotifier(cfg config.Notifications) (*Notifier, error) {
+	client := &http.Client{}
+	n := &Notifier{
+		channels: make(map[string]channel, len(cfg.Channels)),
+		rules:    cfg.Rules,
+	}
+
+	for name, ch := range cfg.Channels {
+		var err error
+		switch ch.Type {
+		case config.NotificationTelegramType:
+			var telegramCfg config.NotificationTelegram
+			if telegramCfg, err = ch.Telegram(); err == nil {
+				n.channels[name] = newTelegram(telegramCfg, client)
+			}
+		case config.NotificationWebhookType:
+			var webhookCfg config.NotificationWebhook
+			if webhookCfg, err = ch.Webhook(); err == nil {
+				n.channels[name] = newWebhook(webhookCfg, client)
+			}
+		case config.NotificationEmailType:
+			var emailCfg config.NotificationEmail
+			if emailCfg, err = ch.Email(); err == nil {
+				n.channels[name] = newEmail(emailCfg)
+			}
+		default:
+			err = config.ErrInvalidChannelType
+		}
+		if err != nil {
+			return nil, fmt.Errorf("notification channel %q: %w", name, err)
+		}
+	}
+
+	return n, nil
+}
+
+// Wants reports whether a rule sends the event of runs of the pipeline template in the owner/repo repository.
+func (n *Notifier) Wants(repository, template string, event config.NotificationEvent) bool {
+	return len(n.channelNames(repository, template, event)) > 0
+}
+
+// Notify sends the message to the channels of the rules matching it, every channel once.
+// Registered secrets are removed from the message first. Failures are only logged.
+func (n *Notifier) Notify(ctx context.Context, msg Message) {
+	msg = msg.redacted()
+
+	for _, name := range n.channelNames(msg.Repository, msg.Pipeline, msg.Event) {
+		ch, ok := n.channels[name]
+		if !ok {
+			continue
+		}
+
+		_, err := pkg.RequestWithRetry(ctx, func(tCtx context.Context) (struct{}, error) {
+			return struct{}{}, ch.send(tCtx, msg)
+		}, func(retryNumber int) {
+			zap.L().Warn(fmt.Sprintf("Retrying notification of run %d to channel '%s', attempt %d", msg.RunID, name, retryNumber))
+		}, pkg.WithAttemptTimeout(sendTimeout, 1), pkg.WithClassifier(classify))
+		if err != nil {
+			zap.L().Error(fmt.Sprintf("Failed to notify channel '%s' of run %d: %v", name, msg.RunID, err))
+		}
+	}
+}
+
+func (n *Notifier) channelNames(repository, template string, event config.NotificationEvent) []string {
+	if n == nil {
+		return nil
+	}
+
+	var names []string
+	for _, rule := range n.rules {
+		if !rule.Match(repository, template, event) {
+			continue
+		}
+		for _, name := range rule.Channels {
+			if !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+
+	return names
+}
+
+// postJSON posts the value as JSON and fails unless the response status is 2xx.
+// Errors do not contain the URL, URLs of bots and webhooks are secrets.
+func postJSON(ctx context.Context, client *http.Client, endpoint string, value any) error {
+	body, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return ErrInvalidEndpoint
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return fmt.Errorf("%w: %w", ErrRequestFailed, urlErr.Err)
+		}
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		return &responseError{resp: resp, body: strings.TrimSpace(string(data))}
+	}
+
+	return nil
+}
+
+// responseError is an unexpected HTTP response of a chat service.
+type responseError struct {
+	resp *http.Response
+	body string
+}
+
+func (e *responseError) Error() string {
+	return fmt.Sprintf("unexpected response status %d: %s", e.resp.StatusCode, e.body)
+}
+
+// classify retries failed HTTP responses like GitHub responses, requests failed without a response
+// and temporary SMTP errors.
+func classify(err error) pkg.RetryDecision {
+	// Requests lose their *url.Error to keep the URL out of errors.
+	if errors.Is(err, ErrRequestFailed) {
+		return pkg.RetryDecision{Retry: true}
+	}
+
+	var respErr *responseError
+	if errors.As(err, &respErr) {
+		return pkg.ClassifyResponse(respErr.resp)
+	}
+
+	var smtpErr *textproto.Error
+	if errors.As(err, &smtpErr) {
+		return pkg.RetryDecision{Retry: smtpErr.Code < 500}
+	}
+
+	return pkg.DefaultRetryClassifier(err)
+}
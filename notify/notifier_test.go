@@ -0,0 +1,220 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"home-ci-cd/config"
+	"home-ci-cd/pkg"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var failedMessage = Message{
+	Event:      config.NotificationFailed,
+	Repository: "owner/repo",
+	Pipeline:   "release/*",
+	RunID:      12,
+	Branch:     "release/1.2",
+	Commit:     "0123456789abcdef",
+	Author:     "Jane Doe",
+	Duration:   83 * time.Second,
+	Error:      "health check failed: GET /health: 503\nmore details",
+	URL:        "https://ci.example.com/runs/12/log",
+}
+
+func TestMessage_Text(t *testing.T) {
+	want := `❌ Run 12 of owner/repo failed
+Pipeline: release/*
+Branch: release/1.2
+Commit: 0123456 by Jane Doe
+Duration: 1m23s
+Error: health check failed: GET /health: 503 …
+Log: https://ci.example.com/runs/12/log
+`
+	if got := failedMessage.Text(); got != want {
+		t.Fatalf("unexpected text:\n%s", got)
+	}
+}
+
+func TestNotifier_SendsToMatchingChannels(t *testing.T) {
+	var mu sync.Mutex
+	requests := make(map[string]map[string]any)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("invalid payload: %v", err)
+		}
+		mu.Lock()
+		requests[r.URL.Path] = payload
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	n, err := NewNotifier(config.Notifications{
+		Channels: map[string]config.NotificationChannel{
+			"telegram": {Type: config.NotificationTelegramType, Data: map[string]any{"botToken": "123:abc", "chatId": "-100"}},
+			"slack":    {Type: config.NotificationWebhookType, Data: map[string]any{"url": srv.URL + "/hooks/slack"}},
+		},
+		Rules: []config.NotificationRule{
+			{Channels: []string{"telegram", "slack"}, Events: []config.NotificationEvent{config.NotificationFailed}},
+			{Channels: []string{"slack"}, Events: []config.NotificationEvent{config.NotificationSucceeded}, Pipelines: []string{"main"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.channels["telegram"].(*telegram).apiURL = srv.URL
+
+	if n.Wants("owner/repo", "release/*", config.NotificationStarted) {
+		t.Fatal("expected started events not to be wanted")
+	}
+	if !n.Wants("owner/repo", "main", config.NotificationRecovered) {
+		t.Fatal("expected succeeded rules to want recovered events")
+	}
+
+	n.Notify(context.Background(), failedMessage)
+
+	telegramPayload := requests["/bot123:abc/sendMessage"]
+	if telegramPayload["chat_id"] != "-100" || telegramPayload["text"] != failedMessage.Text() {
+		t.Fatalf("unexpected telegram payload %v", telegramPayload)
+	}
+	if requests["/hooks/slack"]["text"] != failedMessage.Text() {
+		t.Fatalf("unexpected webhook payload %v", requests["/hooks/slack"])
+	}
+}
+
+func TestNotifier_RedactsSecrets(t *testing.T) {
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer srv.Close()
+
+	n, err := NewNotifier(config.Notifications{
+		Channels: map[string]config.NotificationChannel{
+			"slack": {Type: config.NotificationWebhookType, Data: map[string]any{"url": srv.URL}},
+		},
+		Rules: []config.NotificationRule{
+			{Channels: []string{"slack"}, Events: []config.NotificationEvent{config.NotificationFailed}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pkg.AddSecrets("notify-secret-value")
+	msg := failedMessage
+	msg.Error = "remote command 'docker login -p notify-secret-value' failed"
+	n.Notify(context.Background(), msg)
+
+	if len(body) == 0 || strings.Contains(string(body), "notify-secret-value") {
+		t.Fatalf("expected a payload without the secret, got %q", body)
+	}
+}
+
+func TestNotifier_DoesNotRetryRejectedMessages(t *testing.T) {
+	attempts := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		http.Error(w, "invalid_payload", http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	err := newWebhook(config.NotificationWebhook{URL: srv.URL}, http.DefaultClient).send(context.Background(), failedMessage)
+	if err == nil || strings.Contains(err.Error(), srv.URL) {
+		t.Fatalf("expected an error without the URL, got %v", err)
+	}
+	if decision := classify(err); decision.Retry {
+		t.Fatalf("expected a 400 response not to be retried")
+	}
+}
+
+// smtpServer is a minimal SMTP server accepting one message.
+func smtpServer(t *testing.T) (string, <-chan string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+
+	messages := make(chan string, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		reply := func(line string) { _, _ = conn.Write([]byte(line + "\r\n")) }
+		reply("220 localhost ESMTP")
+
+		var envelope []string
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			command := strings.ToUpper(strings.Fields(line)[0])
+			switch command {
+			case "EHLO", "HELO":
+				reply("250 localhost")
+			case "MAIL", "RCPT":
+				envelope = append(envelope, strings.TrimSpace(line))
+				reply("250 OK")
+			case "DATA":
+				reply("354 Go ahead")
+				var data strings.Builder
+				for {
+					line, err = r.ReadString('\n')
+					if err != nil || line == ".\r\n" {
+						break
+					}
+					data.WriteString(line)
+				}
+				messages <- strings.Join(envelope, "\n") + "\n\n" + data.String()
+				reply("250 OK")
+			case "QUIT":
+				reply("221 Bye")
+				return
+			default:
+				reply("502 Not implemented")
+			}
+		}
+	}()
+
+	return l.Addr().String(), messages
+}
+
+func TestEmail_Send(t *testing.T) {
+	addr, messages := smtpServer(t)
+
+	e := newEmail(config.NotificationEmail{
+		Server: addr,
+		From:   "CI <ci@example.com>",
+		To:     []string{"ops@example.com"},
+	})
+	if err := e.send(context.Background(), failedMessage); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	got := <-messages
+	for _, want := range []string{
+		"MAIL FROM:<ci@example.com>",
+		"RCPT TO:<ops@example.com>",
+		"To: ops@example.com\r\n",
+		"Subject: =?utf-8?q?",
+		"Commit: 0123456 by Jane Doe\r\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("expected %q in message:\n%s", want, got)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package notify
+
+import (
+	"context"
+	"home-ci-cd/config"
+	"net/http"
+)
+
+const telegramAPIURL = "https://api.telegram.org"
+
+// telegram sends messages as a Telegram bot.
+type telegram struct {
+	client *http.Client
+	// Bot API address, replaced in tests
+	apiURL string
+	cfg    config.NotificationTelegram
+}
+
+func newTelegram(cfg config.NotificationTelegram, client *http.Client) *telegram {
+	return &telegram{client: client, apiURL: telegramAPIURL, cfg: cfg}
+}
+
+func (t *telegram) send(ctx context.Context, msg Message) error {
+	return postJSON(ctx, t.client, t.apiURL+"/bot"+t.cfg.BotToken+"/sendMessage", map[string]any{
+		"chat_id":                  t.cfg.ChatID,
+		"text":                     msg.Text(),
+		"disable_web_page_preview": true,
+	})
+}
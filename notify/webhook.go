@@ -0,0 +1,21 @@
+package notify
+
+import (
+	"context"
+	"home-ci-cd/config"
+	"net/http"
+)
+
+// webhook posts messages to a Slack or Mattermost incoming webhook, both accept the text payload.
+type webhook struct {
+	client *http.Client
+	cfg    config.NotificationWebhook
+}
+
+func newWebhook(cfg config.NotificationWebhook, client *http.Client) *webhook {
+	return &webhook{client: client, cfg: cfg}
+}
+
+func (w *webhook) send(ctx context.Context, msg Message) error {
+	return postJSON(ctx, w.client, w.cfg.URL, map[string]string{"text": msg.Text()})
+}
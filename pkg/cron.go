@@ -0,0 +1,212 @@
+package pkg
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidCron = errors.New("invalid cron expression")
+
+// Years searched for the next activation, enough for February 29 on a given weekday.
+const cronSearchYears = 28
+
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+type cronField struct {
+	name     string
+	min, max int
+	names    []string
+}
+
+var cronFields = []cronField{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12, names: []string{"", "jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}},
+	// 7 is Sunday as well.
+	{name: "day of week", min: 0, max: 7, names: []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}},
+}
+
+// CronSchedule is a five field cron expression such as "30 3 * * mon-fri" evaluated in a time zone.
+// Fields accept *, lists, ranges, steps and English month and weekday names, as well as
+// the macros @yearly, @monthly, @weekly, @daily and @hourly. As in cron, a day matches
+// either restricted day of month or day of week when both are restricted.
+type CronSchedule struct {
+	minutes, hours, days, months, weekdays uint64
+	// Set when the field is *, the other day field alone decides then
+	anyDay, anyWeekday bool
+	location           *time.Location
+}
+
+// ParseCron parses the cron expression evaluated in the location, UTC when nil.
+func ParseCron(expr string, location *time.Location) (CronSchedule, error) {
+	if location == nil {
+		location = time.UTC
+	}
+
+	spec := strings.TrimSpace(expr)
+	if macro, ok := cronMacros[strings.ToLower(spec)]; ok {
+		spec = macro
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != len(cronFields) {
+		return CronSchedule{}, fmt.Errorf("%w: %q: expected %d fields, got %d", ErrInvalidCron, expr, len(cronFields), len(fields))
+	}
+
+	bits := make([]uint64, len(fields))
+	for i, field := range fields {
+		var err error
+		if bits[i], err = cronFields[i].parse(field); err != nil {
+			return CronSchedule{}, fmt.Errorf("%w: %q: %w", ErrInvalidCron, expr, err)
+		}
+	}
+
+	weekdays := bits[4]
+	if weekdays&(1<<7) != 0 {
+		weekdays |= 1
+	}
+
+	return CronSchedule{
+		minutes:    bits[0],
+		hours:      bits[1],
+		days:       bits[2],
+		months:     bits[3],
+		weekdays:   weekdays,
+		anyDay:     strings.HasPrefix(fields[2], "*"),
+		anyWeekday: strings.HasPrefix(fields[4], "*"),
+		location:   location,
+	}, nil
+}
+
+func (f cronField) parse(field string) (uint64, error) {
+	var bits uint64
+
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepPart)
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("invalid step %q of %s", stepPart, f.name)
+			}
+			step = n
+		}
+
+		var low, high int
+		switch {
+		case rangePart == "*":
+			low, high = f.min, f.max
+		case strings.Contains(rangePart, "-"):
+			lowPart, highPart, _ := strings.Cut(rangePart, "-")
+			var err error
+			if low, err = f.value(lowPart); err != nil {
+				return 0, err
+			}
+			if high, err = f.value(highPart); err != nil {
+				return 0, err
+			}
+			if low > high {
+				return 0, fmt.Errorf("invalid range %q of %s", rangePart, f.name)
+			}
+		default:
+			var err error
+			if low, err = f.value(rangePart); err != nil {
+				return 0, err
+			}
+			high = low
+			// A single value with a step runs to the end of the field, e.g. 5/15.
+			if hasStep {
+				high = f.max
+			}
+		}
+
+		for v := low; v <= high; v += step {
+			bits |= 1 << v
+		}
+	}
+
+	return bits, nil
+}
+
+func (f cronField) value(s string) (int, error) {
+	for i, name := range f.names {
+		if name != "" && strings.EqualFold(s, name) {
+			return i, nil
+		}
+	}
+
+	n, err := strconv.Atoi(s)
+	if err != nil || n < f.min || n > f.max {
+		return 0, fmt.Errorf("invalid %s %q", f.name, s)
+	}
+
+	return n, nil
+}
+
+// Next returns the first activation after t, the zero time when there is none.
+// Times skipped by a daylight saving change are not activations.
+func (s CronSchedule) Next(t time.Time) time.Time {
+	t = t.In(s.location)
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, s.location)
+	end := day.AddDate(cronSearchYears, 0, 0)
+
+	for ; day.Before(end); day = time.Date(day.Year(), day.Month(), day.Day()+1, 0, 0, 0, 0, s.location) {
+		if !s.matchDay(day) {
+			continue
+		}
+
+		for hour := 0; hour < 24; hour++ {
+			if s.hours&(1<<hour) == 0 {
+				continue
+			}
+			for minute := 0; minute < 60; minute++ {
+				if s.minutes&(1<<minute) == 0 {
+					continue
+				}
+
+				next := time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, s.location)
+				if next.Hour() != hour || next.Minute() != minute {
+					continue
+				}
+				if next.After(t) {
+					return next
+				}
+			}
+		}
+	}
+
+	return time.Time{}
+}
+
+func (s CronSchedule) matchDay(day time.Time) bool {
+	if s.months&(1<<int(day.Month())) == 0 {
+		return false
+	}
+
+	dayMatch := s.days&(1<<day.Day()) != 0
+	weekdayMatch := s.weekdays&(1<<int(day.Weekday())) != 0
+
+	switch {
+	case s.anyDay && s.anyWeekday:
+		return true
+	case s.anyDay:
+		return weekdayMatch
+	case s.anyWeekday:
+		return dayMatch
+	default:
+		return dayMatch || weekdayMatch
+	}
+}
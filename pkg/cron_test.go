@@ -0,0 +1,52 @@
+package pkg
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCronSchedule_Next(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("time zone database unavailable: %v", err)
+	}
+
+	tests := []struct {
+		expr     string
+		location *time.Location
+		after    string
+		want     string
+	}{
+		{"0 3 * * *", time.UTC, "2026-03-10T02:59:00Z", "2026-03-10T03:00:00Z"},
+		{"0 3 * * *", time.UTC, "2026-03-10T03:00:00Z", "2026-03-11T03:00:00Z"},
+		{"*/15 * * * *", time.UTC, "2026-03-10T10:16:30Z", "2026-03-10T10:30:00Z"},
+		{"30 8 * * mon-fri", time.UTC, "2026-03-13T09:00:00Z", "2026-03-16T08:30:00Z"},
+		{"0 0 29 feb *", time.UTC, "2026-03-01T00:00:00Z", "2028-02-29T00:00:00Z"},
+		{"0 12 1 * 7", time.UTC, "2026-03-02T00:00:00Z", "2026-03-08T12:00:00Z"},
+		{"@monthly", time.UTC, "2026-03-10T00:00:00Z", "2026-04-01T00:00:00Z"},
+		{"0 3 * * *", berlin, "2026-03-10T12:00:00Z", "2026-03-11T02:00:00Z"},
+		// 2:30 does not exist on the day daylight saving time starts.
+		{"30 2 * * *", berlin, "2026-03-28T12:00:00Z", "2026-03-30T00:30:00Z"},
+	}
+
+	for _, tt := range tests {
+		s, err := ParseCron(tt.expr, tt.location)
+		if err != nil {
+			t.Fatalf("%q: unexpected error %v", tt.expr, err)
+		}
+		after, _ := time.Parse(time.RFC3339, tt.after)
+		want, _ := time.Parse(time.RFC3339, tt.want)
+		if got := s.Next(after); !got.Equal(want) {
+			t.Fatalf("%q after %s: got %s, want %s", tt.expr, tt.after, got.UTC().Format(time.RFC3339), tt.want)
+		}
+	}
+}
+
+func TestParseCron_Invalid(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* * 0 * *", "* * * * 8", "5-1 * * * *", "*/0 * * * *", "@often"} {
+		if _, err := ParseCron(expr, nil); !errors.Is(err, ErrInvalidCron) {
+			t.Fatalf("%q: expected ErrInvalidCron, got %v", expr, err)
+		}
+	}
+}
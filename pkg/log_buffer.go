@@ -0,0 +1,59 @@
+package pkg
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// LogBuffer collects the output of a pipeline run.
+// It is safe for concurrent use.
+type LogBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func NewLogBuffer() *LogBuffer {
+	return &LogBuffer{}
+}
+
+func (l *LogBuffer) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.buf.Write(p)
+}
+
+// Printf writes a timestamped line.
+func (l *LogBuffer) Printf(format string, args ...any) {
+	line := time.Now().Format(time.RFC3339) + " " + fmt.Sprintf(format, args...) + "\n"
+	_, _ = l.Write([]byte(line))
+}
+
+// Bytes returns a copy of the collected output with registered secrets redacted.
+func (l *LogBuffer) Bytes() []byte {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return []byte(Redact(l.buf.String()))
+}
+
+// Len returns the number of bytes written so far, to be passed to Since.
+func (l *LogBuffer) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.buf.Len()
+}
+
+// Since returns a copy of the output written after offset with registered secrets redacted.
+func (l *LogBuffer) Since(offset int) []byte {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	data := l.buf.Bytes()
+	offset = min(max(offset, 0), len(data))
+
+	return []byte(Redact(string(data[offset:])))
+}
@@ -0,0 +1,52 @@
+package pkg
+
+import (
+	"path"
+	"strings"
+)
+
+// MatchPath reports whether the slash-separated name matches the pattern. Segments of the
+// pattern are matched with path.Match, so * does not cross directories, and a ** segment
+// matches any number of directories, e.g. services/api/** or **/*.md.
+func MatchPath(pattern, name string) (bool, error) {
+	if err := ValidatePathPattern(pattern); err != nil {
+		return false, err
+	}
+
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/")), nil
+}
+
+// ValidatePathPattern checks the syntax of every segment of the pattern.
+func ValidatePathPattern(pattern string) error {
+	for _, segment := range strings.Split(pattern, "/") {
+		if _, err := path.Match(segment, ""); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func matchSegments(pattern, name []string) bool {
+	if len(pattern) == 0 {
+		return len(name) == 0
+	}
+
+	if pattern[0] == "**" {
+		for i := range len(name) + 1 {
+			if matchSegments(pattern[1:], name[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(name) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(pattern[0], name[0]); !ok {
+		return false
+	}
+
+	return matchSegments(pattern[1:], name[1:])
+}
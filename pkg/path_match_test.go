@@ -0,0 +1,34 @@
+package pkg
+
+import "testing"
+
+func TestMatchPath(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{"services/api/**", "services/api/main.go", true},
+		{"services/api/**", "services/api/internal/db/db.go", true},
+		{"services/api/**", "services/web/main.go", false},
+		{"**/*.md", "README.md", true},
+		{"**/*.md", "docs/guide/setup.md", true},
+		{"*.md", "docs/setup.md", false},
+		{"go.mod", "go.mod", true},
+		{"services/*/Dockerfile", "services/api/Dockerfile", true},
+	}
+
+	for _, tt := range tests {
+		got, err := MatchPath(tt.pattern, tt.name)
+		if err != nil {
+			t.Fatalf("%q: unexpected error %v", tt.pattern, err)
+		}
+		if got != tt.want {
+			t.Fatalf("MatchPath(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+
+	if _, err := MatchPath("services/[api", "services/api"); err == nil {
+		t.Fatal("expected an error for a malformed pattern")
+	}
+}
@@ -0,0 +1,104 @@
+package pkg
+
+import (
+	"slices"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	redactedValue = "[REDACTED]"
+	// minSecretLength keeps very short values from being replaced everywhere.
+	minSecretLength = 4
+)
+
+var secrets = &secretSet{}
+
+type secretSet struct {
+	mu       sync.RWMutex
+	values   []string
+	replacer *strings.Replacer
+}
+
+// AddSecrets registers values that are replaced by Redact.
+func AddSecrets(values ...string) {
+	secrets.mu.Lock()
+	defer secrets.mu.Unlock()
+
+	for _, value := range values {
+		if len(value) < minSecretLength || slices.Contains(secrets.values, value) {
+			continue
+		}
+		secrets.values = append(secrets.values, value)
+	}
+
+	// Longer secrets first, so a secret containing another one is replaced whole.
+	slices.SortFunc(secrets.values, func(a, b string) int {
+		return len(b) - len(a)
+	})
+
+	pairs := make([]string, 0, len(secrets.values)*2)
+	for _, value := range secrets.values {
+		pairs = append(pairs, value, redactedValue)
+	}
+	secrets.replacer = strings.NewReplacer(pairs...)
+}
+
+// Redact replaces registered secrets in s.
+func Redact(s string) string {
+	secrets.mu.RLock()
+	defer secrets.mu.RUnlock()
+
+	if secrets.replacer == nil {
+		return s
+	}
+
+	return secrets.replacer.Replace(s)
+}
+
+// redactCore removes registered secrets from log messages and string fields.
+type redactCore struct {
+	zapcore.Core
+}
+
+// NewRedactCore wraps core, it can be passed to zap.WrapCore.
+func NewRedactCore(core zapcore.Core) zapcore.Core {
+	return &redactCore{Core: core}
+}
+
+func (c *redactCore) With(fields []zapcore.Field) zapcore.Core {
+	return &redactCore{Core: c.Core.With(redactFields(fields))}
+}
+
+func (c *redactCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
+	}
+
+	return checked
+}
+
+func (c *redactCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	entry.Message = Redact(entry.Message)
+	return c.Core.Write(entry, redactFields(fields))
+}
+
+func redactFields(fields []zapcore.Field) []zapcore.Field {
+	redacted := make([]zapcore.Field, len(fields))
+	for i, field := range fields {
+		switch field.Type {
+		case zapcore.StringType:
+			field.String = Redact(field.String)
+		case zapcore.ErrorType:
+			if err, ok := field.Interface.(error); ok {
+				field = zapcore.Field{Key: field.Key, Type: zapcore.StringType, String: Redact(err.Error())}
+			}
+		default:
+		}
+		redacted[i] = field
+	}
+
+	return redacted
+}
@@ -3,7 +3,15 @@ package pkg
 import (
 	"context"
 	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
 	"time"
+
+	"github.com/google/go-github/v81/github"
 )
 
 var (
@@ -17,6 +25,14 @@ const (
 	retryStartTimeout = time.Second
 	// retryBackoffFactor is the multiplier applied to the timeout after each failure.
 	retryBackoffFactor = 1.4
+	// retrySleepFactor is the multiplier applied to the pause between attempts after each failure.
+	retrySleepFactor = 2
+	// retryStartSleep is the initial pause between attempts.
+	retryStartSleep = time.Millisecond * 500
+	// retryMaxSleep caps the pause between attempts computed by the backoff.
+	retryMaxSleep = time.Second * 30
+	// retryMaxWait caps the pause requested by the server, longer waits are not retried.
+	retryMaxWait = time.Minute
 )
 
 type (
@@ -29,25 +45,97 @@ type (
 	retryPostActionFn = func(retryNumber int)
 )
 
+// RetryDecision tells RequestWithRetry whether a failed attempt is retried.
+type RetryDecision struct {
+	Retry bool
+	// Pause requested by the server, the backoff is used when zero
+	After time.Duration
+}
+
+// RetryClassifier decides whether the error of an attempt is worth retrying.
+type RetryClassifier = func(err error) RetryDecision
+
+// RetryOption configures RequestWithRetry.
+type RetryOption func(*retryOptions)
+
+type retryOptions struct {
+	attempts       int
+	attemptTimeout time.Duration
+	timeoutFactor  float64
+	sleep          time.Duration
+	maxSleep       time.Duration
+	maxWait        time.Duration
+	classify       RetryClassifier
+}
+
+// WithAttempts sets the number of attempts, including the first one.
+func WithAttempts(attempts int) RetryOption {
+	return func(o *retryOptions) {
+		o.attempts = max(attempts, 1)
+	}
+}
+
+// WithAttemptTimeout sets the timeout of the first attempt and the factor it grows by after each failure.
+func WithAttemptTimeout(timeout time.Duration, factor float64) RetryOption {
+	return func(o *retryOptions) {
+		o.attemptTimeout = timeout
+		o.timeoutFactor = factor
+	}
+}
+
+// WithBackoff sets the first pause between attempts and the limit it grows up to.
+// Pauses requested by the server longer than maxWait stop retrying.
+func WithBackoff(sleep, maxSleep, maxWait time.Duration) RetryOption {
+	return func(o *retryOptions) {
+		o.sleep = sleep
+		o.maxSleep = maxSleep
+		o.maxWait = maxWait
+	}
+}
+
+// WithClassifier replaces DefaultRetryClassifier.
+func WithClassifier(classify RetryClassifier) RetryOption {
+	return func(o *retryOptions) {
+		o.classify = classify
+	}
+}
+
 // RequestWithRetry executes a request with retries.
-// The request is retried sequentially with a per-attempt timeout.
+// The request is retried sequentially with a per-attempt timeout and a jittered
+// exponential pause between attempts, unless the classifier rejects the error.
 // If the parent context is canceled, execution stops immediately.
 // The request function must respect the provided context.
 func RequestWithRetry[ResponseT any](
 	ctx context.Context,
 	request requestFn[ResponseT],
 	retryPostAction retryPostActionFn,
+	opts ...RetryOption,
 ) (ResponseT, error) {
 	var zero ResponseT
 
-	timeout := retryStartTimeout
+	o := retryOptions{
+		attempts:       attemptCount,
+		attemptTimeout: retryStartTimeout,
+		timeoutFactor:  retryBackoffFactor,
+		sleep:          retryStartSleep,
+		maxSleep:       retryMaxSleep,
+		maxWait:        retryMaxWait,
+		classify:       DefaultRetryClassifier,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	timeout := o.attemptTimeout
+	sleep := o.sleep
 
-	for i := range attemptCount {
+	var lastErr error
+	for i := range o.attempts {
 		if ctx.Err() != nil {
-			return zero, ctx.Err()
+			return zero, errors.Join(ctx.Err(), lastErr)
 		}
 
-		if i > 0 {
+		if i > 0 && retryPostAction != nil {
 			retryPostAction(i)
 		}
 
@@ -58,9 +146,124 @@ func RequestWithRetry[ResponseT any](
 		if err == nil {
 			return resp, nil
 		}
+		lastErr = err
+
+		if ctx.Err() != nil {
+			return zero, errors.Join(ctx.Err(), lastErr)
+		}
+
+		decision := o.classify(err)
+		if !decision.Retry {
+			return zero, err
+		}
+		if decision.After > o.maxWait {
+			return zero, fmt.Errorf("server asked to wait %s: %w", decision.After, err)
+		}
+		if i == o.attempts-1 {
+			break
+		}
+
+		pause := decision.After
+		if pause == 0 {
+			pause = jitter(sleep)
+		}
+		if err = sleepContext(ctx, pause); err != nil {
+			return zero, errors.Join(err, lastErr)
+		}
+
+		timeout = time.Duration(float64(timeout) * o.timeoutFactor)
+		sleep = min(sleep*retrySleepFactor, o.maxSleep)
+	}
+
+	return zero, fmt.Errorf("%w: %w", ErrMaxRetriesExceeded, lastErr)
+}
+
+// DefaultRetryClassifier retries network errors, attempt timeouts, 5xx and 429 responses
+// and GitHub rate limits, honoring Retry-After. Other HTTP errors such as 401 or 404 and
+// any other error are returned at once.
+func DefaultRetryClassifier(err error) RetryDecision {
+	var abuseErr *github.AbuseRateLimitError
+	if errors.As(err, &abuseErr) {
+		if abuseErr.RetryAfter != nil {
+			return RetryDecision{Retry: true, After: *abuseErr.RetryAfter}
+		}
+		return RetryDecision{Retry: true, After: retryAfter(abuseErr.Response)}
+	}
 
-		timeout = time.Duration(float64(timeout) * retryBackoffFactor)
+	var rateErr *github.RateLimitError
+	if errors.As(err, &rateErr) {
+		if after := retryAfter(rateErr.Response); after > 0 {
+			return RetryDecision{Retry: true, After: after}
+		}
+		return RetryDecision{Retry: true, After: max(time.Until(rateErr.Rate.Reset.Time), time.Second)}
+	}
+
+	var respErr *github.ErrorResponse
+	if errors.As(err, &respErr) && respErr.Response != nil {
+		return ClassifyResponse(respErr.Response)
+	}
+
+	// Network errors and attempt timeouts have no response.
+	var netErr net.Error
+	var urlErr *url.Error
+	if errors.As(err, &netErr) || errors.As(err, &urlErr) || errors.Is(err, context.DeadlineExceeded) {
+		return RetryDecision{Retry: true}
 	}
 
-	return zero, ErrMaxRetriesExceeded
+	return RetryDecision{}
+}
+
+// ClassifyResponse retries 5xx and 429 responses and 403 responses with Retry-After, honoring Retry-After.
+func ClassifyResponse(resp *http.Response) RetryDecision {
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return RetryDecision{Retry: true, After: retryAfter(resp)}
+	case resp.StatusCode == http.StatusForbidden && resp.Header.Get("Retry-After") != "":
+		// Secondary rate limits of GitHub answer 403 with Retry-After.
+		return RetryDecision{Retry: true, After: retryAfter(resp)}
+	case resp.StatusCode >= http.StatusInternalServerError:
+		return RetryDecision{Retry: true, After: retryAfter(resp)}
+	default:
+		return RetryDecision{}
+	}
+}
+
+// retryAfter parses the Retry-After header given in seconds or as an HTTP date.
+func retryAfter(resp *http.Response) time.Duration {
+	if resp == nil {
+		return 0
+	}
+
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(max(seconds, 0)) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0)
+	}
+
+	return 0
+}
+
+// jitter returns a random duration between d/2 and d.
+func jitter(d time.Duration) time.Duration {
+	if d <= 1 {
+		return d
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
 }
@@ -3,10 +3,23 @@ package pkg
 import (
 	"context"
 	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
 	"testing"
 	"time"
+
+	"github.com/google/go-github/v81/github"
 )
 
+// fastBackoff keeps pauses between attempts short in tests.
+var fastBackoff = WithBackoff(time.Millisecond, time.Millisecond, time.Second)
+
+// errConnRefused is a network error, which is retried.
+var errConnRefused = &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+
 func TestRequestWithRetry_SuccessOnFirstAttempt(t *testing.T) {
 	ctx := context.Background()
 	attempts := 0
@@ -43,7 +56,7 @@ func TestRequestWithRetry_EventualSuccess(t *testing.T) {
 	request := func(tCtx context.Context) (string, error) {
 		attempts++
 		if attempts < 3 {
-			return "", errors.New("fail")
+			return "", errConnRefused
 		}
 		return "success", nil
 	}
@@ -53,7 +66,7 @@ func TestRequestWithRetry_EventualSuccess(t *testing.T) {
 		calledRetries = append(calledRetries, retryNumber)
 	}
 
-	resp, err := RequestWithRetry(ctx, request, retryPostAction)
+	resp, err := RequestWithRetry(ctx, request, retryPostAction, fastBackoff)
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
@@ -72,9 +85,10 @@ func TestRequestWithRetry_ExceedsMaxRetries(t *testing.T) {
 	ctx := context.Background()
 	attempts := 0
 
+	errFail := errConnRefused
 	request := func(tCtx context.Context) (string, error) {
 		attempts++
-		return "", errors.New("fail")
+		return "", errFail
 	}
 
 	var calledRetries []int
@@ -82,10 +96,13 @@ func TestRequestWithRetry_ExceedsMaxRetries(t *testing.T) {
 		calledRetries = append(calledRetries, retryNumber)
 	}
 
-	_, err := RequestWithRetry(ctx, request, retryPostAction)
+	_, err := RequestWithRetry(ctx, request, retryPostAction, fastBackoff)
 	if !errors.Is(err, ErrMaxRetriesExceeded) {
 		t.Fatalf("expected ErrMaxRetriesExceeded, got %v", err)
 	}
+	if !errors.Is(err, errFail) {
+		t.Fatalf("expected the last error to be wrapped, got %v", err)
+	}
 	if attempts != attemptCount {
 		t.Fatalf("expected %d attempts, got %d", attemptCount, attempts)
 	}
@@ -103,7 +120,7 @@ func TestRequestWithRetry_ContextCancelled(t *testing.T) {
 		if attempts == 1 {
 			cancel()
 		}
-		return "", errors.New("fail")
+		return "", errConnRefused
 	}
 
 	var calledRetries []int
@@ -134,7 +151,7 @@ func TestRequestWithRetry_RequestHonorsContextTimeout(t *testing.T) {
 		attempts++
 		if attempts < attemptCount {
 			select {
-			case <-time.After(2 * time.Second):
+			case <-time.After(time.Second):
 				return "success", nil
 			case <-tCtx.Done():
 				return "", tCtx.Err()
@@ -148,7 +165,7 @@ func TestRequestWithRetry_RequestHonorsContextTimeout(t *testing.T) {
 		calledRetries = append(calledRetries, retryNumber)
 	}
 
-	resp, err := RequestWithRetry(ctx, request, retryPostAction)
+	resp, err := RequestWithRetry(ctx, request, retryPostAction, fastBackoff, WithAttemptTimeout(10*time.Millisecond, 1.4))
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
@@ -162,3 +179,77 @@ func TestRequestWithRetry_RequestHonorsContextTimeout(t *testing.T) {
 		t.Fatalf("expected %d retry post actions called, got %d", attemptCount-1, len(calledRetries))
 	}
 }
+
+func githubError(status int, header http.Header) error {
+	return &github.ErrorResponse{
+		Response: &http.Response{
+			StatusCode: status,
+			Header:     header,
+			Request:    &http.Request{Method: http.MethodGet},
+		},
+	}
+}
+
+func TestRequestWithRetry_DoesNotRetryClientErrors(t *testing.T) {
+	for _, status := range []int{http.StatusUnauthorized, http.StatusNotFound} {
+		attempts := 0
+		request := func(tCtx context.Context) (string, error) {
+			attempts++
+			return "", githubError(status, http.Header{})
+		}
+
+		_, err := RequestWithRetry(context.Background(), request, nil, fastBackoff)
+
+		var respErr *github.ErrorResponse
+		if !errors.As(err, &respErr) || errors.Is(err, ErrMaxRetriesExceeded) {
+			t.Fatalf("status %d: expected the response error, got %v", status, err)
+		}
+		if attempts != 1 {
+			t.Fatalf("status %d: expected 1 attempt, got %d", status, attempts)
+		}
+	}
+}
+
+func TestRequestWithRetry_HonorsRetryAfter(t *testing.T) {
+	attempts := 0
+	request := func(tCtx context.Context) (string, error) {
+		attempts++
+		if attempts == 1 {
+			return "", githubError(http.StatusTooManyRequests, http.Header{"Retry-After": {"1"}})
+		}
+		return "success", nil
+	}
+
+	start := time.Now()
+	_, err := RequestWithRetry(context.Background(), request, nil, fastBackoff)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Fatalf("expected to wait for Retry-After, waited %s", elapsed)
+	}
+}
+
+func TestDefaultRetryClassifier(t *testing.T) {
+	retryAfter := 3 * time.Second
+
+	tests := map[string]struct {
+		err  error
+		want RetryDecision
+	}{
+		"server error":         {githubError(http.StatusBadGateway, http.Header{}), RetryDecision{Retry: true}},
+		"too many requests":    {githubError(http.StatusTooManyRequests, http.Header{"Retry-After": {"2"}}), RetryDecision{Retry: true, After: 2 * time.Second}},
+		"forbidden":            {githubError(http.StatusForbidden, http.Header{}), RetryDecision{}},
+		"secondary rate limit": {&github.AbuseRateLimitError{RetryAfter: &retryAfter}, RetryDecision{Retry: true, After: retryAfter}},
+		"attempt timeout":      {context.DeadlineExceeded, RetryDecision{Retry: true}},
+		"network error":        {&net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}, RetryDecision{Retry: true}},
+		"url error":            {&url.Error{Op: "Get", URL: "https://example.com", Err: io.ErrUnexpectedEOF}, RetryDecision{Retry: true}},
+		"other error":          {errors.New("invalid pipeline file"), RetryDecision{}},
+	}
+
+	for name, tt := range tests {
+		if got := DefaultRetryClassifier(tt.err); got != tt.want {
+			t.Fatalf("%s: got %+v, want %+v", name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package pkg
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidVersion      = errors.New("invalid semantic version")
+	ErrInvalidVersionRange = errors.New("invalid version range")
+)
+
+// Version is a semantic version, build metadata is dropped.
+type Version struct {
+	Major      int
+	Minor      int
+	Patch      int
+	Prerelease string
+}
+
+// ParseVersion parses a semantic version such as 1.2.3 or v1.2.3-rc.1+build.5.
+func ParseVersion(s string) (Version, error) {
+	v, partial, err := parseVersion(s)
+	if err != nil {
+		return Version{}, err
+	}
+	if partial {
+		return Version{}, fmt.Errorf("%w: %q", ErrInvalidVersion, s)
+	}
+
+	return v, nil
+}
+
+// parseVersion parses a version whose minor and patch may be omitted, they are then zero.
+func parseVersion(s string) (Version, bool, error) {
+	rest := strings.TrimPrefix(strings.TrimPrefix(s, "v"), "V")
+	rest, _, _ = strings.Cut(rest, "+")
+	rest, prerelease, hasPrerelease := strings.Cut(rest, "-")
+	if hasPrerelease && prerelease == "" {
+		return Version{}, false, fmt.Errorf("%w: %q", ErrInvalidVersion, s)
+	}
+
+	parts := strings.Split(rest, ".")
+	if len(parts) > 3 {
+		return Version{}, false, fmt.Errorf("%w: %q", ErrInvalidVersion, s)
+	}
+
+	numbers := make([]int, 3)
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 || (len(part) > 1 && part[0] == '0') {
+			return Version{}, false, fmt.Errorf("%w: %q", ErrInvalidVersion, s)
+		}
+		numbers[i] = n
+	}
+
+	v := Version{Major: numbers[0], Minor: numbers[1], Patch: numbers[2], Prerelease: prerelease}
+	return v, len(parts) < 3, nil
+}
+
+func (v Version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Prerelease != "" {
+		s += "-" + v.Prerelease
+	}
+
+	return s
+}
+
+// Compare returns -1, 0 or 1 when v is lower, equal or higher than o by semantic version precedence.
+func (v Version) Compare(o Version) int {
+	for _, d := range []int{v.Major - o.Major, v.Minor - o.Minor, v.Patch - o.Patch} {
+		if d != 0 {
+			return sign(d)
+		}
+	}
+
+	switch {
+	case v.Prerelease == o.Prerelease:
+		return 0
+	case v.Prerelease == "":
+		return 1
+	case o.Prerelease == "":
+		return -1
+	}
+
+	a, b := strings.Split(v.Prerelease, "."), strings.Split(o.Prerelease, ".")
+	for i := range min(len(a), len(b)) {
+		if c := comparePrerelease(a[i], b[i]); c != 0 {
+			return c
+		}
+	}
+
+	return sign(len(a) - len(b))
+}
+
+// comparePrerelease compares prerelease identifiers, numeric identifiers are lower than alphanumeric ones.
+func comparePrerelease(a, b string) int {
+	na, errA := strconv.Atoi(a)
+	nb, errB := strconv.Atoi(b)
+
+	switch {
+	case errA == nil && errB == nil:
+		return sign(na - nb)
+	case errA == nil:
+		return -1
+	case errB == nil:
+		return 1
+	default:
+		return strings.Compare(a, b)
+	}
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	default:
+		return 0
+	}
+}
+
+type comparator struct {
+	op      string
+	version Version
+}
+
+func (c comparator) match(v Version) bool {
+	cmp := v.Compare(c.version)
+	switch c.op {
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	default:
+		return cmp == 0
+	}
+}
+
+// VersionRange is a set of versions such as ">=1.2.0 <2.0.0 || ^3.1".
+// Comparators separated by spaces must all match, alternatives are separated by "||".
+// Supported operators are =, >, >=, <, <=, ^ (same major, same minor for 0.x) and ~ (same minor).
+// Prereleases only match alternatives naming a prerelease of the same version.
+type VersionRange struct {
+	alternatives [][]comparator
+}
+
+// ParseVersionRange parses a version range, omitted minor and patch numbers are zero.
+func ParseVersionRange(s string) (VersionRange, error) {
+	var r VersionRange
+
+	for _, alternative := range strings.Split(s, "||") {
+		fields := strings.Fields(alternative)
+		if len(fields) == 0 {
+			return VersionRange{}, fmt.Errorf("%w: %q has an empty alternative", ErrInvalidVersionRange, s)
+		}
+
+		var comparators []comparator
+		for _, field := range fields {
+			op := strings.TrimRight(field, "0123456789.vV-+abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ")
+			v, _, err := parseVersion(field[len(op):])
+			if err != nil {
+				return VersionRange{}, fmt.Errorf("%w: %q: %w", ErrInvalidVersionRange, s, err)
+			}
+
+			switch op {
+			case "^":
+				upper := Version{Major: v.Major + 1}
+				if v.Major == 0 {
+					upper = Version{Minor: v.Minor + 1}
+				}
+				comparators = append(comparators, comparator{">=", v}, comparator{"<", upper})
+			case "~":
+				comparators = append(comparators, comparator{">=", v}, comparator{"<", Version{Major: v.Major, Minor: v.Minor + 1}})
+			case "", "=", ">", ">=", "<", "<=":
+				comparators = append(comparators, comparator{op, v})
+			default:
+				return VersionRange{}, fmt.Errorf("%w: %q: unknown operator %q", ErrInvalidVersionRange, s, op)
+			}
+		}
+		r.alternatives = append(r.alternatives, comparators)
+	}
+
+	return r, nil
+}
+
+// Contains reports whether the version is in the range.
+func (r VersionRange) Contains(v Version) bool {
+	for _, comparators := range r.alternatives {
+		if matchAll(comparators, v) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func matchAll(comparators []comparator, v Version) bool {
+	prereleaseAllowed := v.Prerelease == ""
+	for _, c := range comparators {
+		if !c.match(v) {
+			return false
+		}
+		if c.version.Prerelease != "" && c.version.Major == v.Major && c.version.Minor == v.Minor && c.version.Patch == v.Patch {
+			prereleaseAllowed = true
+		}
+	}
+
+	return prereleaseAllowed
+}
@@ -0,0 +1,70 @@
+package pkg
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseVersion(t *testing.T) {
+	v, err := ParseVersion("v1.12.3-rc.1+build.7")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if v != (Version{Major: 1, Minor: 12, Patch: 3, Prerelease: "rc.1"}) {
+		t.Fatalf("unexpected version %+v", v)
+	}
+
+	for _, s := range []string{"1.2", "release-1", "1.02.3", "1.2.3-", ""} {
+		if _, err = ParseVersion(s); !errors.Is(err, ErrInvalidVersion) {
+			t.Fatalf("%q: expected ErrInvalidVersion, got %v", s, err)
+		}
+	}
+}
+
+func TestVersion_Compare(t *testing.T) {
+	ordered := []string{"1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-alpha.beta", "1.0.0-beta.2", "1.0.0-beta.11", "1.0.0", "1.0.1", "1.10.0"}
+	for i := 1; i < len(ordered); i++ {
+		a, _ := ParseVersion(ordered[i-1])
+		b, _ := ParseVersion(ordered[i])
+		if a.Compare(b) != -1 || b.Compare(a) != 1 {
+			t.Fatalf("expected %s < %s", a, b)
+		}
+	}
+}
+
+func TestVersionRange_Contains(t *testing.T) {
+	tests := []struct {
+		versionRange string
+		version      string
+		want         bool
+	}{
+		{">=1.2.0 <2.0.0", "1.9.4", true},
+		{">=1.2.0 <2.0.0", "2.0.0", false},
+		{"^1.2", "1.8.0", true},
+		{"^1.2", "1.1.9", false},
+		{"^0.3.1", "0.4.0", false},
+		{"~1.2.3", "1.2.9", true},
+		{"~1.2.3", "1.3.0", false},
+		{"<1.0.0 || >=3", "3.1.0", true},
+		{"1.2.3", "1.2.3", true},
+		{">=1.0.0", "1.1.0-rc.1", false},
+		{">=1.1.0-rc.0", "1.1.0-rc.1", true},
+	}
+
+	for _, tt := range tests {
+		r, err := ParseVersionRange(tt.versionRange)
+		if err != nil {
+			t.Fatalf("%q: unexpected error %v", tt.versionRange, err)
+		}
+		v, _ := ParseVersion(tt.version)
+		if got := r.Contains(v); got != tt.want {
+			t.Fatalf("%q contains %s = %v, want %v", tt.versionRange, tt.version, got, tt.want)
+		}
+	}
+
+	for _, s := range []string{"", ">=1 ||", "!1.0.0", ">=x"} {
+		if _, err := ParseVersionRange(s); !errors.Is(err, ErrInvalidVersionRange) {
+			t.Fatalf("%q: expected ErrInvalidVersionRange, got %v", s, err)
+		}
+	}
+}
@@ -0,0 +1,305 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"home-ci-cd/config"
+	"home-ci-cd/db"
+	"home-ci-cd/pkg"
+	"home-ci-cd/server"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v81/github"
+	"go.uber.org/zap"
+)
+
+// Check run statuses and conclusions accepted by GitHub.
+const (
+	checkStatusQueued     = "queued"
+	checkStatusInProgress = "in_progress"
+	checkStatusCompleted  = "completed"
+
+	checkConclusionSuccess   = "success"
+	checkConclusionFailure   = "failure"
+	checkConclusionTimedOut  = "timed_out"
+	checkConclusionCancelled = "cancelled"
+	checkConclusionSkipped   = "skipped"
+)
+
+const (
+	// Lines of the failing step output shown in the check run
+	checkLogTailLines = 50
+	// GitHub limits check run output texts to 65535 characters.
+	maxCheckText = 65535
+)
+
+// dockerStepRegexp matches the step headers printed by the classic Docker builder, e.g. "Step 3/7 : RUN make".
+var dockerStepRegexp = regexp.MustCompile(`Step (\d+)/(\d+) :`)
+
+// step is a finished stage of a run.
+type step struct {
+	name     string
+	duration time.Duration
+	err      error
+	// Output written by the step, only kept when it failed
+	output      []byte
+	annotations []*github.CheckRunAnnotation
+}
+
+// runSteps records the stages of a run for the check run summary.
+type runSteps struct {
+	log   *pkg.LogBuffer
+	steps []*step
+}
+
+func newRunSteps(log *pkg.LogBuffer) *runSteps {
+	return &runSteps{log: log}
+}
+
+// run runs fn as a stage with the timeout and records its duration and result.
+func (s *runSteps) run(ctx context.Context, name string, timeout time.Duration, fn func(ctx context.Context) error) error {
+	offset := s.log.Len()
+	start := time.Now()
+
+	err := stage(ctx, name, timeout, fn)
+
+	st := &step{name: name, duration: time.Since(start), err: err}
+	if err != nil {
+		st.output = s.log.Since(offset)
+	}
+	s.steps = append(s.steps, st)
+
+	return err
+}
+
+// failed returns the step that failed the run, nil when all steps passed.
+func (s *runSteps) failed() *step {
+	if len(s.steps) == 0 || s.steps[len(s.steps)-1].err == nil {
+		return nil
+	}
+
+	return s.steps[len(s.steps)-1]
+}
+
+// summary renders the steps as a Markdown table.
+func (s *runSteps) summary() string {
+	if len(s.steps) == 0 {
+		return "No steps were run."
+	}
+
+	var b strings.Builder
+	b.WriteString("| Step | Result | Duration |\n| --- | --- | --- |\n")
+	for _, st := range s.steps {
+		result := "✅ passed"
+		switch {
+		case errors.Is(st.err, ErrTimedOut):
+			result = "⏱️ timed out"
+		case st.err != nil:
+			result = "❌ failed"
+		}
+		fmt.Fprintf(&b, "| %s | %s | %s |\n", st.name, result, st.duration.Round(time.Millisecond))
+	}
+
+	return b.String()
+}
+
+// text renders the tail of the output of the failing step.
+func (s *runSteps) text() string {
+	failed := s.failed()
+	if failed == nil || len(failed.output) == 0 {
+		return ""
+	}
+
+	header := fmt.Sprintf("### Output of the %s step\n\n```text\n", failed.name)
+	footer := "\n```\n"
+	tail := truncateHead(tailLines(failed.output, checkLogTailLines), maxCheckText-len(header)-len(footer))
+
+	return header + tail + footer
+}
+
+// tailLines returns the last n lines of data.
+func tailLines(data []byte, n int) string {
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// truncateHead drops the beginning of s so it fits into n bytes.
+func truncateHead(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+
+	s = s[len(s)-n:]
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[i+1:]
+	}
+
+	return s
+}
+
+// annotateBuild points the failed build step at the Dockerfile instruction of the Docker step
+// mentioned in its output. Only Dockerfiles from the repository can be annotated.
+func annotateBuild(failed *step, pipeline config.BranchPipeline, repoPath string) {
+	if failed == nil || !pipeline.FromRepository() {
+		return
+	}
+
+	matches := dockerStepRegexp.FindAllSubmatch(failed.output, -1)
+	if len(matches) == 0 {
+		return
+	}
+	last := matches[len(matches)-1]
+	number, err := strconv.Atoi(string(last[1]))
+	if err != nil {
+		return
+	}
+
+	dockerfile, err := os.ReadFile(filepath.Join(repoPath, pipeline.DockerFilePath))
+	if err != nil {
+		zap.L().Error(err.Error())
+		return
+	}
+	line, ok := dockerfileInstructionLine(dockerfile, number)
+	if !ok {
+		return
+	}
+
+	failed.annotations = append(failed.annotations, &github.CheckRunAnnotation{
+		Path:            github.Ptr(filepath.ToSlash(pipeline.DockerFilePath)),
+		StartLine:       github.Ptr(line),
+		EndLine:         github.Ptr(line),
+		AnnotationLevel: github.Ptr("failure"),
+		Title:           github.Ptr(fmt.Sprintf("Step %s/%s failed", last[1], last[2])),
+		Message:         github.Ptr(pkg.Redact(failed.err.Error())),
+	})
+}
+
+// dockerfileInstructionLine returns the line the nth instruction of the Dockerfile starts at.
+// Comments, empty lines and continuation lines are not instructions.
+func dockerfileInstructionLine(dockerfile []byte, n int) (int, bool) {
+	count := 0
+	continued := false
+
+	for i, line := range bytes.Split(dockerfile, []byte("\n")) {
+		trimmed := strings.TrimSpace(string(line))
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		if !continued {
+			count++
+			if count == n {
+				return i + 1, true
+			}
+		}
+		continued = strings.HasSuffix(trimmed, "\\")
+	}
+
+	return 0, false
+}
+
+// checkConclusion maps the final status of a run to a check run conclusion.
+func checkConclusion(status db.RunStatus) string {
+	switch status {
+	case db.RunStatusSuccess:
+		return checkConclusionSuccess
+	case db.RunStatusTimedOut:
+		return checkConclusionTimedOut
+	case db.RunStatusSuperseded, db.RunStatusInterrupted:
+		return checkConclusionCancelled
+	case db.RunStatusSkipped:
+		return checkConclusionSkipped
+	default:
+		return checkConclusionFailure
+	}
+}
+
+// createCheckRun creates the queued check run of the run when checks are enabled.
+func (r *GithubRepository) createCheckRun(ctx context.Context, run *db.Run, pipeline config.BranchPipeline) {
+	if !r.cfg.Checks {
+		return
+	}
+
+	opts := github.CreateCheckRunOptions{
+		Name:       statusContext(pipeline),
+		HeadSHA:    run.Commit,
+		ExternalID: github.Ptr(strconv.FormatUint(run.ID, 10)),
+		Status:     github.Ptr(checkStatusQueued),
+	}
+	if url := server.RunLogURL(r.logServer, run.ID); url != "" {
+		opts.DetailsURL = github.Ptr(url)
+	}
+
+	checkRun, err := pkg.RequestWithRetry(context.WithoutCancel(ctx), func(tCtx context.Context) (*github.CheckRun, error) {
+		checkRun, _, err := r.client.Checks.CreateCheckRun(tCtx, r.cfg.Owner, r.cfg.Repo, opts)
+		return checkRun, err
+	}, func(retryNumber int) {
+		zap.L().Warn(fmt.Sprintf("Retrying check run of run %d, attempt %d", run.ID, retryNumber))
+	})
+	if err != nil {
+		zap.L().Error(fmt.Sprintf("Failed to create check run of run %d: %v", run.ID, err))
+		return
+	}
+
+	run.CheckRunID = checkRun.GetID()
+}
+
+// startCheckRun marks the check run of the run as in progress.
+func (r *GithubRepository) startCheckRun(ctx context.Context, run *db.Run, pipeline config.BranchPipeline) {
+	r.updateCheckRun(ctx, run, github.UpdateCheckRunOptions{
+		Name:   statusContext(pipeline),
+		Status: github.Ptr(checkStatusInProgress),
+	})
+}
+
+// completeCheckRun concludes the check run of the run with a summary of its steps.
+func (r *GithubRepository) completeCheckRun(ctx context.Context, run *db.Run, pipeline config.BranchPipeline, steps *runSteps) {
+	_, title := statusState(run)
+	output := &github.CheckRunOutput{
+		Title:   github.Ptr(title),
+		Summary: github.Ptr(steps.summary()),
+	}
+	if text := steps.text(); text != "" {
+		output.Text = github.Ptr(text)
+	}
+	if failed := steps.failed(); failed != nil {
+		output.Annotations = failed.annotations
+	}
+
+	r.updateCheckRun(ctx, run, github.UpdateCheckRunOptions{
+		Name:        statusContext(pipeline),
+		Status:      github.Ptr(checkStatusCompleted),
+		Conclusion:  github.Ptr(checkConclusion(run.Status)),
+		CompletedAt: &github.Timestamp{Time: run.FinishedAt},
+		Output:      output,
+	})
+}
+
+// updateCheckRun updates the check run of the run, if it was created. Failures are only logged,
+// they never fail the run.
+func (r *GithubRepository) updateCheckRun(ctx context.Context, run *db.Run, opts github.UpdateCheckRunOptions) {
+	if !r.cfg.Checks || run.CheckRunID == 0 {
+		return
+	}
+
+	_, err := pkg.RequestWithRetry(context.WithoutCancel(ctx), func(tCtx context.Context) (*github.CheckRun, error) {
+		checkRun, _, err := r.client.Checks.UpdateCheckRun(tCtx, r.cfg.Owner, r.cfg.Repo, run.CheckRunID, opts)
+		return checkRun, err
+	}, func(retryNumber int) {
+		zap.L().Warn(fmt.Sprintf("Retrying check run of run %d, attempt %d", run.ID, retryNumber))
+	})
+	if err != nil {
+		zap.L().Error(fmt.Sprintf("Failed to update check run of run %d: %v", run.ID, err))
+	}
+}
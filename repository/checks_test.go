@@ -0,0 +1,104 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"home-ci-cd/config"
+	"home-ci-cd/db"
+	"home-ci-cd/pkg"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v81/github"
+)
+
+func TestAnnotateBuild(t *testing.T) {
+	repoPath := t.TempDir()
+	dockerfile := `# syntax=docker/dockerfile:1
+FROM golang:1.25
+
+WORKDIR /src
+# dependencies first
+RUN apt-get update && \
+    apt-get install -y make
+COPY . .
+RUN make build
+`
+	if err := os.MkdirAll(filepath.Join(repoPath, "deploy"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(repoPath, "deploy", "Dockerfile"), []byte(dockerfile), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	failed := &step{
+		name:   "build",
+		err:    errors.New("The command '/bin/sh -c make build' returned a non-zero code: 2"),
+		output: []byte("Step 1/5 : FROM golang:1.25\nStep 4/5 : COPY . .\nStep 5/5 : RUN make build\nmake: *** [build] Error 1\n"),
+	}
+	pipelines, err := config.ParsePipelineFile([]byte("branchPipelines:\n  - template: main\n    dockerFilePath: deploy/Dockerfile\n"), config.PipelinePolicy{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	annotateBuild(failed, pipelines[0], repoPath)
+
+	if len(failed.annotations) != 1 {
+		t.Fatalf("expected one annotation, got %d", len(failed.annotations))
+	}
+	annotation := failed.annotations[0]
+	if annotation.GetPath() != "deploy/Dockerfile" || annotation.GetStartLine() != 9 || annotation.GetTitle() != "Step 5/5 failed" {
+		t.Fatalf("unexpected annotation %+v", annotation)
+	}
+}
+
+func TestCompleteCheckRun(t *testing.T) {
+	var got github.UpdateCheckRunOptions
+	path := ""
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("malformed body: %v", err)
+		}
+		_, _ = w.Write([]byte(`{"id": 7}`))
+	}))
+	defer srv.Close()
+
+	r := &GithubRepository{
+		cfg:    config.Repository{Owner: "owner", Repo: "repo", Checks: true},
+		client: NewGithubClient(GithubEndpoint{BaseURL: srv.URL, Transport: http.DefaultTransport}, "token"),
+	}
+
+	log := pkg.NewLogBuffer()
+	steps := newRunSteps(log)
+	_ = steps.run(context.Background(), "download", 0, func(ctx context.Context) error {
+		return nil
+	})
+	_ = steps.run(context.Background(), "build", 0, func(ctx context.Context) error {
+		log.Printf("compiling")
+		return errors.New("build failed")
+	})
+
+	run := &db.Run{ID: 3, Commit: "abc", Status: db.RunStatusFailed, Error: "build failed", FinishedAt: time.Now(), CheckRunID: 7}
+	r.completeCheckRun(context.Background(), run, config.BranchPipeline{Template: "main"}, steps)
+
+	if path != "/api/v3/repos/owner/repo/check-runs/7" {
+		t.Fatalf("unexpected path %q", path)
+	}
+	if got.GetStatus() != checkStatusCompleted || got.GetConclusion() != checkConclusionFailure || got.Name != "home-ci-cd/main" {
+		t.Fatalf("unexpected check run %+v", got)
+	}
+	summary := got.GetOutput().GetSummary()
+	if !strings.Contains(summary, "| download | ✅ passed |") || !strings.Contains(summary, "| build | ❌ failed |") {
+		t.Fatalf("unexpected summary %q", summary)
+	}
+	if !strings.Contains(got.GetOutput().GetText(), "compiling") {
+		t.Fatalf("expected the build output in the text, got %q", got.GetOutput().GetText())
+	}
+}
@@ -3,5 +3,12 @@ package repository
 import "errors"
 
 var (
-	ErrInvalidGitType = errors.New("invalid git type")
+	ErrInvalidGitType       = errors.New("invalid git type")
+	ErrPipelineNotFound     = errors.New("no pipeline matches branch")
+	ErrRepositoryNotFound   = errors.New("repository is not configured")
+	ErrSuperseded           = errors.New("superseded by a newer commit")
+	ErrInterrupted          = errors.New("interrupted by shutdown")
+	ErrTimedOut             = errors.New("timed out")
+	ErrInstallationNotFound = errors.New("GitHub App installation not found")
+	ErrInvalidCABundle      = errors.New("no certificates found in CA bundle")
 )
@@ -0,0 +1,198 @@
+package repository
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"home-ci-cd/config"
+	"home-ci-cd/pkg"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v81/github"
+	"go.uber.org/zap"
+)
+
+const (
+	// appJWTLifetime is below the 10 minute maximum accepted by GitHub.
+	appJWTLifetime = time.Minute * 9
+	// appJWTClockSkew backdates the JWT to tolerate clock drift.
+	appJWTClockSkew = time.Minute
+	// installationTokenRefresh is how long before expiry an installation token is replaced.
+	installationTokenRefresh = time.Minute * 5
+)
+
+// GithubApp authenticates as a GitHub App: it signs JWTs with the app key and
+// exchanges them for installation tokens, which are refreshed before they expire.
+type GithubApp struct {
+	cred     config.CredentialGithubApp
+	key      *rsa.PrivateKey
+	endpoint GithubEndpoint
+	// Client authenticated with the app JWT
+	client *github.Client
+
+	mu sync.Mutex
+	// Installation tokens by installation ID
+	tokens map[int64]*github.InstallationToken
+	// Looked up installation IDs by owner
+	installations map[string]int64
+}
+
+// NewGithubApp creates an app of the endpoint authenticating with the credential.
+func NewGithubApp(endpoint GithubEndpoint, cred config.CredentialGithubApp) (*GithubApp, error) {
+	key, err := cred.RSAPrivateKey()
+	if err != nil {
+		return nil, err
+	}
+
+	app := &GithubApp{
+		cred:          cred,
+		key:           key,
+		endpoint:      endpoint,
+		tokens:        make(map[int64]*github.InstallationToken),
+		installations: make(map[string]int64),
+	}
+	app.client = endpoint.newClient(&http.Client{
+		Transport: &appTransport{app: app, base: endpoint.Transport},
+	})
+
+	return app, nil
+}
+
+// jwt returns a token authenticating as the app, signed with RS256.
+func (a *GithubApp) jwt() (string, error) {
+	now := time.Now()
+
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]any{
+		"iat": now.Add(-appJWTClockSkew).Unix(),
+		"exp": now.Add(appJWTLifetime).Unix(),
+		"iss": strconv.FormatInt(a.cred.AppID, 10),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, a.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// installationID returns the installation of the app for the owner: the configured one,
+// or the installation found on the owner's organization or user account.
+func (a *GithubApp) installationID(ctx context.Context, owner string) (int64, error) {
+	if id, ok := a.cred.Installations[owner]; ok {
+		return id, nil
+	}
+	if a.cred.InstallationID != 0 {
+		return a.cred.InstallationID, nil
+	}
+
+	a.mu.Lock()
+	id, ok := a.installations[owner]
+	a.mu.Unlock()
+	if ok {
+		return id, nil
+	}
+
+	installation, _, err := a.client.Apps.FindOrganizationInstallation(ctx, owner)
+	var respErr *github.ErrorResponse
+	if errors.As(err, &respErr) && respErr.Response.StatusCode == http.StatusNotFound {
+		installation, _, err = a.client.Apps.FindUserInstallation(ctx, owner)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("%w for owner %s: %w", ErrInstallationNotFound, owner, err)
+	}
+
+	a.mu.Lock()
+	a.installations[owner] = installation.GetID()
+	a.mu.Unlock()
+
+	zap.L().Info(fmt.Sprintf("Using installation %d of GitHub App %d for %s", installation.GetID(), a.cred.AppID, owner))
+
+	return installation.GetID(), nil
+}
+
+// Token returns an installation token for the owner, creating a new one
+// when there is none or the current one is about to expire.
+func (a *GithubApp) Token(ctx context.Context, owner string) (string, error) {
+	id, err := a.installationID(ctx, owner)
+	if err != nil {
+		return "", err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if token, ok := a.tokens[id]; ok && time.Until(token.GetExpiresAt().Time) > installationTokenRefresh {
+		return token.GetToken(), nil
+	}
+
+	token, _, err := a.client.Apps.CreateInstallationToken(ctx, id, nil)
+	if err != nil {
+		return "", err
+	}
+	pkg.AddSecrets(token.GetToken())
+	a.tokens[id] = token
+
+	zap.L().Info(fmt.Sprintf(
+		"Created token of installation %d valid until %s",
+		id,
+		token.GetExpiresAt().Format(time.RFC3339),
+	))
+
+	return token.GetToken(), nil
+}
+
+// appTransport authenticates requests as the app.
+type appTransport struct {
+	app  *GithubApp
+	base http.RoundTripper
+}
+
+func (t *appTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	jwt, err := t.app.jwt()
+	if err != nil {
+		return nil, err
+	}
+
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+jwt)
+
+	return t.base.RoundTrip(req)
+}
+
+// installationTransport authenticates requests with the installation token of the owner.
+type installationTransport struct {
+	app   *GithubApp
+	owner string
+	base  http.RoundTripper
+}
+
+func (t *installationTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.app.Token(req.Context(), t.owner)
+	if err != nil {
+		return nil, err
+	}
+
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "token "+token)
+
+	return t.base.RoundTrip(req)
+}
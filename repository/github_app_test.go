@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"home-ci-cd/config"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// verifyJWT checks the RS256 signature and returns the claims of the token.
+func verifyJWT(t *testing.T, token string, key *rsa.PublicKey) map[string]any {
+	t.Helper()
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		t.Fatalf("malformed jwt %q", token)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		t.Fatalf("malformed signature: %v", err)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		t.Fatalf("invalid signature: %v", err)
+	}
+
+	payload, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	var claims map[string]any
+	if err = json.Unmarshal(payload, &claims); err != nil {
+		t.Fatalf("malformed claims: %v", err)
+	}
+
+	return claims
+}
+
+func TestGithubApp_InstallationTokens(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	tokensCreated := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		path := strings.TrimPrefix(r.URL.Path, "/api/v3")
+
+		switch {
+		case path == "/orgs/alice/installation":
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"message": "Not Found"}`))
+		case path == "/users/alice/installation":
+			claims := verifyJWT(t, strings.TrimPrefix(auth, "Bearer "), &key.PublicKey)
+			if claims["iss"] != "42" {
+				t.Errorf("unexpected issuer %v", claims["iss"])
+			}
+			_, _ = w.Write([]byte(`{"id": 7}`))
+		case path == "/app/installations/7/access_tokens":
+			verifyJWT(t, strings.TrimPrefix(auth, "Bearer "), &key.PublicKey)
+			tokensCreated++
+			expiresAt := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+			_, _ = fmt.Fprintf(w, `{"token": "installation-token", "expires_at": %q}`, expiresAt)
+		case path == "/repos/alice/repo":
+			if auth != "token installation-token" {
+				t.Errorf("unexpected authorization %q", auth)
+			}
+			_, _ = w.Write([]byte(`{"name": "repo"}`))
+		default:
+			t.Errorf("unexpected request %s", path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	app, err := NewGithubApp(GithubEndpoint{BaseURL: srv.URL, Transport: http.DefaultTransport}, config.CredentialGithubApp{
+		AppID:      42,
+		PrivateKey: string(keyPEM),
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	client := NewGithubAppClient(app, "alice")
+
+	for range 2 {
+		if _, _, err = client.Repositories.Get(context.Background(), "alice", "repo"); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+
+	if tokensCreated != 1 {
+		t.Fatalf("expected the installation token to be reused, created %d", tokensCreated)
+	}
+}
@@ -0,0 +1,255 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v81/github"
+	"go.uber.org/zap"
+)
+
+const (
+	// Share of the limit below which polling slows down
+	rateLimitSlowShare = 0.25
+	// Share of the limit below which polling pauses until the reset
+	rateLimitPauseShare = 0.02
+)
+
+type conditionalKey struct{}
+
+// conditional marks requests whose responses are cached by ETag, so repeated
+// requests for unchanged data are answered with 304 and do not count against the rate limit.
+func conditional(ctx context.Context) context.Context {
+	return context.WithValue(ctx, conditionalKey{}, true)
+}
+
+// GithubClient is a GitHub API client tracking the rate limit of its token.
+type GithubClient struct {
+	*github.Client
+	RateLimit *RateLimit
+}
+
+// NewGithubClient creates a client of the endpoint authenticated with the token.
+func NewGithubClient(endpoint GithubEndpoint, token string) *GithubClient {
+	c := newGithubClient(endpoint, endpoint.Transport)
+	c.Client = c.WithAuthToken(token)
+	return c
+}
+
+// NewGithubAppClient creates a client authenticated with installation tokens of the app for the owner.
+func NewGithubAppClient(app *GithubApp, owner string) *GithubClient {
+	return newGithubClient(app.endpoint, &installationTransport{
+		app:   app,
+		owner: owner,
+		base:  app.endpoint.Transport,
+	})
+}
+
+func newGithubClient(endpoint GithubEndpoint, base http.RoundTripper) *GithubClient {
+	rateLimit := &RateLimit{}
+	httpClient := &http.Client{
+		Transport: &conditionalTransport{
+			base:      base,
+			rateLimit: rateLimit,
+			cache:     make(map[string]cachedResponse),
+		},
+	}
+
+	return &GithubClient{
+		Client:    endpoint.newClient(httpClient),
+		RateLimit: rateLimit,
+	}
+}
+
+type cachedResponse struct {
+	etag   string
+	header http.Header
+	body   []byte
+}
+
+// conditionalTransport records rate limit headers of every response and serves
+// conditional requests from its cache when GitHub answers 304 Not Modified.
+type conditionalTransport struct {
+	base      http.RoundTripper
+	rateLimit *RateLimit
+
+	mu    sync.Mutex
+	cache map[string]cachedResponse
+}
+
+func (t *conditionalTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet || req.Context().Value(conditionalKey{}) == nil {
+		resp, err := t.base.RoundTrip(req)
+		if err == nil {
+			t.rateLimit.update(resp.Header)
+		}
+		return resp, err
+	}
+
+	key := req.URL.String()
+	t.mu.Lock()
+	cached, ok := t.cache[key]
+	t.mu.Unlock()
+
+	if ok {
+		req = req.Clone(req.Context())
+		req.Header.Set("If-None-Match", cached.etag)
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	t.rateLimit.update(resp.Header)
+
+	switch {
+	case ok && resp.StatusCode == http.StatusNotModified:
+		_ = resp.Body.Close()
+
+		header := cached.header.Clone()
+		for _, name := range []string{headerRateLimit, headerRateRemaining, headerRateReset} {
+			if value := resp.Header.Get(name); value != "" {
+				header.Set(name, value)
+			}
+		}
+
+		return &http.Response{
+			Status:        "200 OK",
+			StatusCode:    http.StatusOK,
+			Proto:         resp.Proto,
+			ProtoMajor:    resp.ProtoMajor,
+			ProtoMinor:    resp.ProtoMinor,
+			Header:        header,
+			Body:          io.NopCloser(bytes.NewReader(cached.body)),
+			ContentLength: int64(len(cached.body)),
+			Request:       req,
+		}, nil
+	case resp.StatusCode == http.StatusOK && resp.Header.Get("ETag") != "":
+		body, err := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		t.mu.Lock()
+		t.cache[key] = cachedResponse{
+			etag:   resp.Header.Get("ETag"),
+			header: resp.Header.Clone(),
+			body:   body,
+		}
+		t.mu.Unlock()
+
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		return resp, nil
+	default:
+		return resp, nil
+	}
+}
+
+const (
+	headerRateLimit     = "X-RateLimit-Limit"
+	headerRateRemaining = "X-RateLimit-Remaining"
+	headerRateReset     = "X-RateLimit-Reset"
+)
+
+type throttleState int
+
+const (
+	throttleNone throttleState = iota
+	throttleSlow
+	throttlePause
+)
+
+// RateLimit keeps the latest rate limit reported by GitHub for a token.
+type RateLimit struct {
+	mu        sync.Mutex
+	known     bool
+	limit     int
+	remaining int
+	reset     time.Time
+	state     throttleState
+}
+
+func (l *RateLimit) update(header http.Header) {
+	limit, err := strconv.Atoi(header.Get(headerRateLimit))
+	if err != nil || limit <= 0 {
+		return
+	}
+	remaining, err := strconv.Atoi(header.Get(headerRateRemaining))
+	if err != nil {
+		return
+	}
+	reset, err := strconv.ParseInt(header.Get(headerRateReset), 10, 64)
+	if err != nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.known = true
+	l.limit = limit
+	l.remaining = remaining
+	l.reset = time.Unix(reset, 0)
+}
+
+// Delay returns how long a poller should wait before its next request instead of interval.
+// Polling slows down in proportion to the remaining budget once it falls below a quarter
+// of the limit and pauses until the reset when the budget is almost exhausted.
+func (l *RateLimit) Delay(interval time.Duration) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	untilReset := time.Until(l.reset)
+	if !l.known || untilReset <= 0 {
+		l.setState(throttleNone, 0)
+		return interval
+	}
+
+	share := float64(l.remaining) / float64(l.limit)
+	switch {
+	case share <= rateLimitPauseShare:
+		l.setState(throttlePause, untilReset)
+		return max(untilReset, interval)
+	case share < rateLimitSlowShare:
+		l.setState(throttleSlow, untilReset)
+		delay := time.Duration(float64(interval) * rateLimitSlowShare / share)
+		return max(min(delay, untilReset), interval)
+	default:
+		l.setState(throttleNone, 0)
+		return interval
+	}
+}
+
+// setState logs transitions between throttling states. Must be called with mu held.
+func (l *RateLimit) setState(state throttleState, untilReset time.Duration) {
+	if state == l.state {
+		return
+	}
+	l.state = state
+
+	switch state {
+	case throttlePause:
+		zap.L().Warn(fmt.Sprintf(
+			"GitHub rate limit almost exhausted (%d of %d left), pausing polling for %s",
+			l.remaining,
+			l.limit,
+			untilReset.Round(time.Second),
+		))
+	case throttleSlow:
+		zap.L().Warn(fmt.Sprintf(
+			"GitHub rate limit is running low (%d of %d left), slowing down polling until reset in %s",
+			l.remaining,
+			l.limit,
+			untilReset.Round(time.Second),
+		))
+	default:
+		zap.L().Info("GitHub rate limit recovered, polling at the normal rate")
+	}
+}
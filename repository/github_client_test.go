@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestGithubClient_ConditionalRequests(t *testing.T) {
+	requests, notModified := 0, 0
+	reset := strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set(headerRateLimit, "5000")
+		w.Header().Set(headerRateRemaining, strconv.Itoa(5000-requests*2400))
+		w.Header().Set(headerRateReset, reset)
+
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		_, _ = w.Write([]byte(`{"name": "main", "commit": {"sha": "abc"}}`))
+	}))
+	defer srv.Close()
+
+	client := NewGithubClient(GithubEndpoint{BaseURL: srv.URL, Transport: http.DefaultTransport}, "token")
+
+	for range 2 {
+		branch, _, err := client.Repositories.GetBranch(conditional(context.Background()), "owner", "repo", "main", 0)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if branch.GetCommit().GetSHA() != "abc" {
+			t.Fatalf("unexpected commit %q", branch.GetCommit().GetSHA())
+		}
+	}
+
+	if requests != 2 || notModified != 1 {
+		t.Fatalf("expected the second request to be conditional, got %d requests and %d not modified", requests, notModified)
+	}
+
+	// 200 of 5000 requests left: polling slows down.
+	if delay := client.RateLimit.Delay(5 * time.Second); delay <= 5*time.Second || delay > time.Hour {
+		t.Fatalf("expected slower polling, got %s", delay)
+	}
+}
+
+func TestRateLimit_Delay(t *testing.T) {
+	reset := time.Now().Add(10 * time.Minute)
+	interval := 5 * time.Second
+
+	tests := map[int]func(time.Duration) bool{
+		4000: func(d time.Duration) bool { return d == interval },
+		500:  func(d time.Duration) bool { return d == 12500*time.Millisecond },
+		50:   func(d time.Duration) bool { return d > 9*time.Minute },
+	}
+
+	for remaining, ok := range tests {
+		l := &RateLimit{known: true, limit: 5000, remaining: remaining, reset: reset}
+		if delay := l.Delay(interval); !ok(delay) {
+			t.Fatalf("remaining %d: unexpected delay %s", remaining, delay)
+		}
+	}
+}
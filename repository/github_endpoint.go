@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"home-ci-cd/config"
+	"net/http"
+	"os"
+
+	"github.com/google/go-github/v81/github"
+)
+
+// GithubEndpoint is the GitHub instance clients talk to, api.github.com by default.
+type GithubEndpoint struct {
+	// Enterprise API and upload URLs, empty for api.github.com
+	BaseURL   string
+	UploadURL string
+	// Transport trusting the configured CA bundle
+	Transport http.RoundTripper
+}
+
+// NewGithubEndpoint creates the endpoint described by the config.
+func NewGithubEndpoint(cfg config.Github) (GithubEndpoint, error) {
+	endpoint := GithubEndpoint{
+		BaseURL:   cfg.BaseURL,
+		UploadURL: cfg.UploadURL,
+		Transport: http.DefaultTransport,
+	}
+
+	if cfg.CABundle == "" {
+		return endpoint, nil
+	}
+
+	bundle, err := os.ReadFile(cfg.CABundle)
+	if err != nil {
+		return GithubEndpoint{}, err
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(bundle) {
+		return GithubEndpoint{}, fmt.Errorf("%w: %s", ErrInvalidCABundle, cfg.CABundle)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	endpoint.Transport = transport
+
+	return endpoint, nil
+}
+
+// newClient creates a client for the endpoint sending requests through httpClient.
+func (e GithubEndpoint) newClient(httpClient *http.Client) *github.Client {
+	client := github.NewClient(httpClient)
+	if e.BaseURL == "" {
+		return client
+	}
+
+	uploadURL := e.UploadURL
+	if uploadURL == "" {
+		uploadURL = e.BaseURL
+	}
+
+	// The URLs are validated with the config.
+	enterpriseClient, err := client.WithEnterpriseURLs(e.BaseURL, uploadURL)
+	if err != nil {
+		return client
+	}
+
+	return enterpriseClient
+}
@@ -5,18 +5,27 @@ import (
 	"bytes"
 	"context"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"home-ci-cd/config"
 	"home-ci-cd/db"
+	"home-ci-cd/deploy"
+	"home-ci-cd/notify"
+	"home-ci-cd/pkg"
+	"home-ci-cd/scheduler"
 	"io"
 	"math/rand"
+	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
 	"sync"
 	"time"
 
 	"github.com/docker/docker/api/types/build"
+	"github.com/docker/docker/api/types/registry"
 	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/jsonmessage"
 	"github.com/google/go-github/v81/github"
 	"go.uber.org/zap"
 )
@@ -31,32 +40,93 @@ type GithubRepository struct {
 	db              db.DB
 	bufferDirectory string
 	cfg             config.Repository
-	client          *github.Client
+	credentials     map[string]config.Credential
+	environments    map[string]config.Environment
+	scheduler       *scheduler.Scheduler
+	notifier        *notify.Notifier
+	// Run log server, signing links in commit statuses
+	logServer config.Server
+	client    *GithubClient
+
+	lanesMu sync.Mutex
+	// Runs of branch pipelines, by branch and template
+	lanes map[string]*lane
+	// Set by Shutdown, no runs are started afterwards
+	closed bool
+	// Parent of run contexts, canceled when Shutdown runs out of time
+	runsCtx    context.Context
+	cancelRuns context.CancelCauseFunc
+	workers    sync.WaitGroup
 }
 
-func NewGithubRepository(client *github.Client, cfg config.Repository, bufferDirectory string, db db.DB) *GithubRepository {
+func NewGithubRepository(
+	client *GithubClient,
+	cfg config.Repository,
+	credentials map[string]config.Credential,
+	environments map[string]config.Environment,
+	scheduler *scheduler.Scheduler,
+	notifier *notify.Notifier,
+	logServer config.Server,
+	bufferDirectory string,
+	db db.DB,
+) *GithubRepository {
 	rand.Seed(time.Now().UnixNano())
+	runsCtx, cancelRuns := context.WithCancelCause(context.Background())
 	return &GithubRepository{
 		client:          client,
 		cfg:             cfg,
+		credentials:     credentials,
+		environments:    environments,
+		scheduler:       scheduler,
+		notifier:        notifier,
+		logServer:       logServer,
+		lanes:           make(map[string]*lane),
+		runsCtx:         runsCtx,
+		cancelRuns:      cancelRuns,
 		bufferDirectory: bufferDirectory,
 		db:              db,
 	}
 }
 
 func (r *GithubRepository) WatchBranches(ctx context.Context) {
-	for _, pipeline := range r.cfg.BranchPipelines {
-		branches, err := r.branchesForTemplate(ctx, pipeline.Template)
+	if len(r.cfg.PullRequestPipelines) > 0 {
+		go r.watchPullRequests(ctx)
+	}
+	if len(r.cfg.TagPipelines) > 0 {
+		go r.watchTags(ctx)
+	}
+
+	pipelines, err := r.branchPipelines(ctx, "")
+	if err != nil {
+		zap.L().Error(err.Error())
+		return
+	}
+
+	for _, pipeline := range pipelines {
+		branches, err := r.branchesForPipeline(ctx, pipeline)
 		if err != nil {
 			zap.L().Error(err.Error())
 			return
 		}
 
 		for _, branch := range branches {
+			if pipeline.FromRepository() && !r.cfg.PipelinePolicy.BranchAllowed(branch.GetName()) {
+				continue
+			}
+
+			if pipeline.Schedule != nil {
+				go r.watchSchedule(ctx, branch.GetName(), pipeline)
+			}
+
 			go func() {
 				for {
-					r.pipeline(ctx, branch, pipeline)
-					time.Sleep(watchPipelineSleepDuration)
+					r.pipeline(ctx, branch.GetName(), pipeline)
+
+					select {
+					case <-ctx.Done():
+						return
+					case <-time.After(r.client.RateLimit.Delay(watchPipelineSleepDuration)):
+					}
 				}
 			}()
 		}
@@ -64,26 +134,31 @@ func (r *GithubRepository) WatchBranches(ctx context.Context) {
 
 }
 
-func (r *GithubRepository) branchesForTemplate(ctx context.Context, template string) ([]*github.Branch, error) {
+// branchesForPipeline returns the branches matching the templates and the protection filter of the pipeline.
+func (r *GithubRepository) branchesForPipeline(ctx context.Context, pipeline config.BranchPipeline) ([]*github.Branch, error) {
 	var branches []*github.Branch
 
-	isProtected := false
 	opts := &github.BranchListOptions{
-		Protected: &isProtected,
 		ListOptions: github.ListOptions{
 			PerPage: BranchListPerPageOption,
 		},
 	}
+	switch pipeline.Protected {
+	case config.ProtectedOnly:
+		opts.Protected = github.Ptr(true)
+	case config.ProtectedNone:
+		opts.Protected = github.Ptr(false)
+	}
 
 	for {
-		brs, resp, err := r.client.Repositories.ListBranches(ctx, r.cfg.Owner, r.cfg.Repo, opts)
+		brs, resp, err := r.client.Repositories.ListBranches(conditional(ctx), r.cfg.Owner, r.cfg.Repo, opts)
 		if err != nil {
 			zap.L().Error(err.Error())
 			return nil, err
 		}
 
 		for _, branch := range brs {
-			match, err := filepath.Match(template, branch.GetName())
+			match, err := pipeline.MatchBranch(branch.GetName())
 			if err != nil {
 				zap.L().Error(err.Error())
 				return nil, err
@@ -104,56 +179,502 @@ func (r *GithubRepository) branchesForTemplate(ctx context.Context, template str
 	return branches, nil
 }
 
-func (r *GithubRepository) pipeline(ctx context.Context, branch *github.Branch, pipeline config.BranchPipeline) {
-	actualCommit := branch.Commit.GetSHA()
-	branchName := branch.GetName()
-	repoPath := filepath.Join(r.bufferDirectory, r.cfg.Repo+"_"+branchName)
+// Trigger runs the pipeline matching the branch once, even if the commit was already built.
+// The branch head is used when commit is empty.
+func (r *GithubRepository) Trigger(ctx context.Context, branchName, commit string) (db.Run, error) {
+	var err error
+	if commit == "" {
+		if commit, err = r.branchHead(ctx, branchName); err != nil {
+			zap.L().Error(err.Error())
+			return db.Run{}, err
+		}
+	}
+
+	pipeline, err := r.Pipeline(ctx, branchName, commit)
+	if err != nil {
+		return db.Run{}, err
+	}
+
+	run, err := r.runPipeline(ctx, branchName, commit, pipeline, db.RunTriggerManual)
+	if run == nil {
+		return db.Run{}, err
+	}
+
+	return *run, err
+}
+
+func (r *GithubRepository) Rollback(ctx context.Context, pipeline config.BranchPipeline, target db.Run, liveCommit string) (db.Run, error) {
+	lr, err := r.enqueue(ctx, &db.Run{
+		Branch:   target.Branch,
+		Commit:   target.Commit,
+		ImageTag: target.ImageTag,
+		Trigger:  db.RunTriggerRollback,
+		// Holds the replaced commit back from automatic builds and rollbacks.
+		RolledBackFrom: liveCommit,
+	}, pipeline)
+	if err != nil {
+		return db.Run{}, err
+	}
+
+	<-lr.done
+	return *lr.run, lr.err
+}
 
-	isNewVersion, err := r.isRepoNewVersion(ctx, actualCommit, branchName)
+func (r *GithubRepository) Pipeline(ctx context.Context, branchName, commit string) (config.BranchPipeline, error) {
+	pipeline, ok, err := r.pipelineForCommit(ctx, branchName, commit)
+	if err != nil {
+		zap.L().Error(err.Error())
+		return config.BranchPipeline{}, err
+	}
+	if !ok {
+		return config.BranchPipeline{}, ErrPipelineNotFound
+	}
+
+	return pipeline, nil
+}
+
+func (r *GithubRepository) pipeline(ctx context.Context, branchName string, pipeline config.BranchPipeline) {
+	head, err := r.branchHeadCommit(ctx, branchName)
+	if err != nil {
+		zap.L().Error(err.Error())
+		return
+	}
+	actualCommit := head.GetSHA()
+
+	isNewVersion, err := r.isRepoNewVersion(ctx, actualCommit, branchName, pipeline)
 	if err != nil {
 		zap.L().Error(err.Error())
 		return
 	}
 	if !isNewVersion {
-		zap.L().Info(fmt.Sprintf("Branch '%s' is up-to-date, skipping pipeline", branch.GetName()))
+		zap.L().Info(fmt.Sprintf("Branch '%s' is up-to-date, skipping pipeline", branchName))
 		return
 	}
 
-	if err = r.pullRepos(ctx, branchName, repoPath, actualCommit); err != nil {
-		zap.L().Error(err.Error())
+	// Pipelines from the pipeline file are taken from the commit being built.
+	if pipeline.FromRepository() {
+		var ok bool
+		if pipeline, ok, err = r.pipelineForCommit(ctx, branchName, actualCommit); err != nil {
+			zap.L().Error(err.Error())
+			return
+		}
+		if !ok {
+			zap.L().Info(fmt.Sprintf("Branch '%s' has no pipeline at commit '%s', skipping", branchName, actualCommit))
+			return
+		}
+	}
+
+	run := &db.Run{
+		Branch:  branchName,
+		Commit:  actualCommit,
+		Trigger: db.RunTriggerPush,
+	}
+
+	if r.applySkipDirective(ctx, run, &pipeline, head.GetCommit().GetMessage()) {
 		return
 	}
+
+	if pipeline.HasPathFilters() {
+		match, err := r.branchChangesMatch(ctx, branchName, actualCommit, pipeline)
+		if err != nil {
+			zap.L().Error(err.Error())
+			return
+		}
+		if !match {
+			r.skipRun(ctx, run, pipeline, skipReasonPaths)
+			return
+		}
+	}
+
+	// Runs outlive the watch context, they are stopped by Shutdown.
+	lr, err := r.enqueue(context.WithoutCancel(ctx), run, pipeline)
+	if err != nil || lr == nil {
+		return
+	}
+
+	go func() {
+		<-lr.done
+		zap.L().Info(fmt.Sprintf(
+			"Pipeline completed for branch '%s' at commit '%s' with status '%s'",
+			branchName,
+			actualCommit,
+			lr.run.Status,
+		))
+	}()
+}
+
+// branchPipelines returns pipelines of the central config followed by pipelines
+// from the pipeline file at ref, the default branch is used when ref is empty.
+func (r *GithubRepository) branchPipelines(ctx context.Context, ref string) ([]config.BranchPipeline, error) {
+	pipelines := slices.Clone(r.cfg.BranchPipelines)
+	if r.cfg.PipelineFile == "" {
+		return pipelines, nil
+	}
+
+	var opts *github.RepositoryContentGetOptions
+	if ref != "" {
+		opts = &github.RepositoryContentGetOptions{Ref: ref}
+	}
+
+	fileContent, _, resp, err := r.client.Repositories.GetContents(ctx, r.cfg.Owner, r.cfg.Repo, r.cfg.PipelineFile, opts)
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			zap.L().Warn(fmt.Sprintf("Pipeline file '%s' not found in %s/%s at '%s'", r.cfg.PipelineFile, r.cfg.Owner, r.cfg.Repo, ref))
+			return pipelines, nil
+		}
+		zap.L().Error(err.Error())
+		return nil, err
+	}
+
+	data, err := fileContent.GetContent()
+	if err != nil {
+		zap.L().Error(err.Error())
+		return nil, err
+	}
+
+	filePipelines, err := config.ParsePipelineFile([]byte(data), r.cfg.PipelinePolicy, r.credentials, r.environments)
+	if err != nil {
+		zap.L().Error(fmt.Sprintf("Invalid pipeline file of %s/%s at '%s': %v", r.cfg.Owner, r.cfg.Repo, ref, err))
+		return nil, err
+	}
+
+	return append(pipelines, filePipelines...), nil
+}
+
+// pipelineForCommit returns the first pipeline matching the branch among pipelines defined at the commit.
+func (r *GithubRepository) pipelineForCommit(ctx context.Context, branchName, commit string) (config.BranchPipeline, bool, error) {
+	pipelines, err := r.branchPipelines(ctx, commit)
+	if err != nil {
+		return config.BranchPipeline{}, false, err
+	}
+
+	for _, pipeline := range pipelines {
+		if pipeline.FromRepository() && !r.cfg.PipelinePolicy.BranchAllowed(branchName) {
+			continue
+		}
+
+		repo := config.Repository{BranchPipelines: []config.BranchPipeline{pipeline}}
+		_, ok, err := repo.PipelineForBranch(branchName)
+		if err != nil {
+			return config.BranchPipeline{}, false, err
+		}
+		if ok {
+			return pipeline, true, nil
+		}
+	}
+
+	return config.BranchPipeline{}, false, nil
+}
+
+func (r *GithubRepository) branchHead(ctx context.Context, branchName string) (string, error) {
+	commit, err := r.branchHeadCommit(ctx, branchName)
+	if err != nil {
+		return "", err
+	}
+
+	return commit.GetSHA(), nil
+}
+
+func (r *GithubRepository) branchHeadCommit(ctx context.Context, branchName string) (*github.RepositoryCommit, error) {
+	branch, _, err := r.client.Repositories.GetBranch(conditional(ctx), r.cfg.Owner, r.cfg.Repo, branchName, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return branch.GetCommit(), nil
+}
+
+// runPipeline queues a run of the pipeline for the commit and waits until it finishes.
+func (r *GithubRepository) runPipeline(ctx context.Context, branchName, commit string, pipeline config.BranchPipeline, trigger db.RunTrigger) (*db.Run, error) {
+	lr, err := r.enqueue(ctx, &db.Run{Branch: branchName, Commit: commit, Trigger: trigger}, pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	<-lr.done
+	return lr.run, lr.err
+}
+
+// execRun waits for a scheduler worker and executes the pending run.
+func (r *GithubRepository) execRun(ctx context.Context, run *db.Run, pipeline config.BranchPipeline) error {
+	repoPath := r.workspace(run)
+	log := pkg.NewLogBuffer()
+	steps := newRunSteps(log)
+
+	r.createCheckRun(ctx, run, pipeline)
+
+	repoLimit, pipelineLimit := r.scheduler.Limits(r.cfg, pipeline)
+	release, err := r.scheduler.Acquire(ctx, scheduler.Job{
+		Repository:      r.cfg.Owner + "/" + r.cfg.Repo,
+		Pipeline:        pipeline.Template,
+		Branch:          run.Branch,
+		RepositoryLimit: repoLimit,
+		PipelineLimit:   pipelineLimit,
+	})
+	if err != nil {
+		zap.L().Error(err.Error())
+		r.finishRun(ctx, run, pipeline, steps, err)
+		return err
+	}
+	defer release()
+
+	if r.isClosed() {
+		r.finishRun(ctx, run, pipeline, steps, ErrInterrupted)
+		return ErrInterrupted
+	}
+
+	run.Status = db.RunStatusRunning
+	run.StartedAt = time.Now()
+	if err = r.db.SaveRun(ctx, run); err != nil {
+		zap.L().Error(err.Error())
+		r.finishRun(ctx, run, pipeline, steps, err)
+		return err
+	}
+
+	log.Printf("Run %d of %s/%s branch '%s' at commit '%s' triggered by %s", run.ID, run.Owner, run.Repo, run.Branch, run.Commit, run.Trigger)
+	r.reportStatus(ctx, run, pipeline)
+	r.startCheckRun(ctx, run, pipeline)
+	r.notifyStarted(ctx, run, pipeline)
+
+	execCtx, cancel := withTimeout(ctx, "pipeline", pipeline.Timeout)
+	defer cancel()
+
+	err = timedOut(execCtx, r.execute(execCtx, run, pipeline, repoPath, steps))
+	r.finishRun(ctx, run, pipeline, steps, err)
+
+	return err
+}
+
+func (r *GithubRepository) execute(ctx context.Context, run *db.Run, pipeline config.BranchPipeline, repoPath string, steps *runSteps) error {
+	if run.Trigger == db.RunTriggerRollback {
+		return r.redeploy(ctx, run, pipeline, steps)
+	}
+
+	timeouts := pipeline.StageTimeouts
+	log := steps.log
+
+	log.Printf("Downloading repository files")
 	defer r.clearDirectory(repoPath)
+	err := steps.run(ctx, "download", timeouts.Download, func(ctx context.Context) error {
+		return r.pullRepos(ctx, run.Branch, repoPath, run.Commit)
+	})
+	if err != nil {
+		zap.L().Error(err.Error())
+		return err
+	}
 
-	imageReader, err := r.createImage(ctx, pipeline, repoPath)
+	log.Printf("Building image")
+	var imageTag string
+	err = steps.run(ctx, "build", timeouts.Build, func(ctx context.Context) error {
+		imageTag, err = r.createImage(ctx, run, pipeline, repoPath, log)
+		return err
+	})
 	if err != nil {
 		zap.L().Error(err.Error())
-		return
+		annotateBuild(steps.failed(), pipeline, repoPath)
+		return err
 	}
-	defer func() {
-		if err = imageReader.Close(); err != nil {
+	run.ImageTag = imageTag
+	log.Printf("Built image '%s'", imageTag)
+
+	if len(pipeline.RemoteCommands) > 0 {
+		log.Printf("Deploying image '%s'", imageTag)
+		err = steps.run(ctx, "deploy", timeouts.Deploy, func(ctx context.Context) error {
+			return r.deploy(ctx, run, pipeline, log)
+		})
+		if err != nil {
 			zap.L().Error(err.Error())
+			return err
 		}
-	}()
+		if run.Status == db.RunStatusRolledBack {
+			return nil
+		}
+	} else if run.Reason != "" {
+		log.Printf("Not deploying: %s", run.Reason)
+	}
 
-	if err = r.db.SaveLastCommit(ctx, r.cfg.Owner, r.cfg.Repo, branch.GetName(), actualCommit); err != nil {
+	// Heads of pull requests and tags are recorded when the run finishes.
+	if run.PullRequest != 0 || run.Tag != "" {
+		return nil
+	}
+	if err = r.db.SaveLastCommit(ctx, r.cfg.Owner, r.cfg.Repo, run.Branch, pipeline.Template, run.Commit); err != nil {
 		zap.L().Error(err.Error())
-		return
+		return err
 	}
 
+	return nil
+}
+
+// redeploy executes a rollback run, which deploys the image of an earlier run without building it.
+func (r *GithubRepository) redeploy(ctx context.Context, run *db.Run, pipeline config.BranchPipeline, steps *runSteps) error {
+	log := steps.log
+
 	zap.L().Info(fmt.Sprintf(
-		"Pipeline completed for branch '%s' at commit '%s'",
-		branch.GetName(),
-		branch.Commit.GetSHA(),
+		"Rolling back %s/%s branch '%s' from commit '%s' to image '%s' of commit '%s'",
+		r.cfg.Owner,
+		r.cfg.Repo,
+		run.Branch,
+		run.RolledBackFrom,
+		run.ImageTag,
+		run.Commit,
+	))
+	log.Printf("Rolling back to image '%s' of commit '%s'", run.ImageTag, run.Commit)
+
+	err := steps.run(ctx, "deploy", pipeline.StageTimeouts.Deploy, func(ctx context.Context) error {
+		deployer, err := r.deployer(pipeline, log)
+		if err != nil {
+			return err
+		}
+		return deployer.Deploy(ctx, pipeline, *run)
+	})
+	if err != nil {
+		zap.L().Error(err.Error())
+		return err
+	}
+
+	if err = r.db.SaveLastCommit(ctx, r.cfg.Owner, r.cfg.Repo, run.Branch, pipeline.Template, run.Commit); err != nil {
+		zap.L().Error(err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// deployer returns a deployer to the environment of the pipeline.
+func (r *GithubRepository) deployer(pipeline config.BranchPipeline, log *pkg.LogBuffer) (*deploy.Deployer, error) {
+	env, ok := r.environments[pipeline.Environment]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", config.ErrEnvironmentNotFound, pipeline.Environment)
+	}
+	cred, ok := r.credentials[env.Credential]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", config.ErrCredentialNotFound, env.Credential)
+	}
+
+	deployer, err := deploy.NewDeployer(env, cred, log)
+	if err != nil {
+		zap.L().Error(err.Error())
+		return nil, err
+	}
+
+	return deployer, nil
+}
+
+// deploy runs the deploy stage and, when the health check fails or the deploy times out,
+// redeploys the image of the last successful run of the branch.
+func (r *GithubRepository) deploy(ctx context.Context, run *db.Run, pipeline config.BranchPipeline, log *pkg.LogBuffer) error {
+	deployer, err := r.deployer(pipeline, log)
+	if err != nil {
+		return err
+	}
+
+	err = deployer.Deploy(ctx, pipeline, *run)
+	if err == nil {
+		return nil
+	}
+	// A timed out deploy may leave hosts half updated.
+	err = timedOut(ctx, err)
+	if !errors.Is(err, deploy.ErrHealthCheckFailed) && !errors.Is(err, ErrTimedOut) {
+		return err
+	}
+
+	ctx, cancel := withRollbackTimeout(ctx, pipeline)
+	defer cancel()
+
+	previous, prevErr := r.previousDeployment(ctx, run, pipeline)
+	if prevErr != nil {
+		zap.L().Error(prevErr.Error())
+		return errors.Join(err, prevErr)
+	}
+
+	zap.L().Warn(fmt.Sprintf(
+		"Rolling back branch '%s' from commit '%s' to image '%s' of commit '%s'",
+		run.Branch,
+		run.Commit,
+		previous.ImageTag,
+		previous.Commit,
 	))
+	log.Printf("Rolling back to image '%s' of commit '%s'", previous.ImageTag, previous.Commit)
+
+	if rollbackErr := deployer.Deploy(ctx, pipeline, previous); rollbackErr != nil {
+		rollbackErr = timedOut(ctx, rollbackErr)
+		zap.L().Error(rollbackErr.Error())
+		return errors.Join(err, rollbackErr)
+	}
+
+	run.Status = db.RunStatusRolledBack
+	run.Error = err.Error()
+
+	return nil
 }
 
-func (r *GithubRepository) createFile(ctx context.Context, entry *github.TreeEntry, repoPath string, errCh chan<- error, cancel context.CancelFunc, wg *sync.WaitGroup) {
+// previousDeployment returns the deployed run to roll back to when the deploy of the run fails.
+// Tag runs each have their own branch, so the last deployed tag of the pipeline is used for them.
+func (r *GithubRepository) previousDeployment(ctx context.Context, run *db.Run, pipeline config.BranchPipeline) (db.Run, error) {
+	filter := db.RunFilter{
+		Owner:    r.cfg.Owner,
+		Repo:     r.cfg.Repo,
+		Branch:   run.Branch,
+		Pipeline: pipeline.Template,
+	}
+	if run.Trigger == db.RunTriggerTag {
+		filter.Branch = ""
+		filter.Trigger = db.RunTriggerTag
+	}
+
+	return deploy.LastSuccessfulRun(ctx, r.db, filter)
+}
+
+func (r *GithubRepository) finishRun(ctx context.Context, run *db.Run, pipeline config.BranchPipeline, steps *runSteps, err error) {
+	log := steps.log
+	run.FinishedAt = time.Now()
+	switch {
+	case err != nil && errors.Is(context.Cause(ctx), ErrSuperseded):
+		run.Status = db.RunStatusSuperseded
+		run.Error = ErrSuperseded.Error()
+		log.Printf("Run canceled: %v", ErrSuperseded)
+	case err != nil && (errors.Is(err, ErrInterrupted) || errors.Is(context.Cause(ctx), ErrInterrupted)):
+		run.Status = db.RunStatusInterrupted
+		run.Error = ErrInterrupted.Error()
+		log.Printf("Run canceled: %v", ErrInterrupted)
+	case errors.Is(err, ErrTimedOut):
+		run.Status = db.RunStatusTimedOut
+		run.Error = err.Error()
+		log.Printf("Run canceled: %v", err)
+	case err != nil:
+		run.Status = db.RunStatusFailed
+		run.Error = err.Error()
+		log.Printf("Run failed: %v", err)
+	case run.Status == db.RunStatusRunning:
+		run.Status = db.RunStatusSuccess
+	}
+	log.Printf("Run finished with status '%s'", run.Status)
+
+	ctx = context.WithoutCancel(ctx)
+	if err = r.db.SaveRun(ctx, run); err != nil {
+		zap.L().Error(err.Error())
+	}
+	if err = r.db.SaveRunLog(ctx, run.ID, log.Bytes()); err != nil {
+		zap.L().Error(err.Error())
+	}
+
+	r.reportStatus(ctx, run, pipeline)
+	r.completeCheckRun(ctx, run, pipeline, steps)
+	r.notifyFinished(ctx, run, pipeline)
+	if run.PullRequest != 0 {
+		r.finishPullRequest(ctx, run, pipeline)
+	}
+	if run.Tag != "" {
+		r.finishTag(ctx, run)
+	}
+}
+
+func (r *GithubRepository) createFile(ctx context.Context, entry *github.TreeEntry, repoPath, commit string, errCh chan<- error, cancel context.CancelFunc, wg *sync.WaitGroup) {
 	defer wg.Done()
 
 	path := entry.GetPath()
 
-	fileContent, _, _, err := r.client.Repositories.GetContents(ctx, r.cfg.Owner, r.cfg.Repo, path, nil)
+	fileContent, _, _, err := r.client.Repositories.GetContents(ctx, r.cfg.Owner, r.cfg.Repo, path, &github.RepositoryContentGetOptions{Ref: commit})
 	if err != nil {
 		select {
 		case errCh <- err:
@@ -195,14 +716,58 @@ func (r *GithubRepository) createFile(ctx context.Context, entry *github.TreeEnt
 	}
 }
 
-func (r *GithubRepository) isRepoNewVersion(ctx context.Context, commit, branchName string) (bool, error) {
-	lastCommit, err := r.db.GetLastCommit(ctx, r.cfg.Owner, r.cfg.Repo, branchName)
+// isRepoNewVersion reports whether the commit was not built by the pipeline yet. A commit whose run failed, timed out
+// or was rolled back waits for a manual run, unless the pipeline retries failed commits.
+// A commit replaced by the rollback command is not built again.
+func (r *GithubRepository) isRepoNewVersion(ctx context.Context, commit, branchName string, pipeline config.BranchPipeline) (bool, error) {
+	lastCommit, err := r.db.GetLastCommit(ctx, r.cfg.Owner, r.cfg.Repo, branchName, pipeline.Template)
 	if err != nil {
 		zap.L().Error(err.Error())
 		return false, err
 	}
+	if lastCommit == commit {
+		return false, nil
+	}
 
-	return lastCommit == commit, nil
+	// A commit replaced by the rollback command is only built again by a manual run.
+	rollbacks, err := r.db.ListRuns(ctx, db.RunFilter{
+		Owner:    r.cfg.Owner,
+		Repo:     r.cfg.Repo,
+		Branch:   branchName,
+		Pipeline: pipeline.Template,
+		Status:   db.RunStatusSuccess,
+		Trigger:  db.RunTriggerRollback,
+		Limit:    1,
+	})
+	if err != nil {
+		zap.L().Error(err.Error())
+		return false, err
+	}
+	if len(rollbacks) > 0 && rollbacks[0].RolledBackFrom == commit {
+		return false, nil
+	}
+
+	if pipeline.RetryFailed {
+		return true, nil
+	}
+
+	runs, err := r.db.ListRuns(ctx, db.RunFilter{
+		Owner:    r.cfg.Owner,
+		Repo:     r.cfg.Repo,
+		Branch:   branchName,
+		Pipeline: pipeline.Template,
+		Commit:   commit,
+		Limit:    1,
+	})
+	if err != nil {
+		zap.L().Error(err.Error())
+		return false, err
+	}
+	if len(runs) > 0 && slices.Contains([]db.RunStatus{db.RunStatusFailed, db.RunStatusTimedOut, db.RunStatusRolledBack}, runs[0].Status) {
+		return false, nil
+	}
+
+	return true, nil
 }
 
 func (r *GithubRepository) pullRepos(ctx context.Context, branchName, repoPath, commit string) error {
@@ -213,12 +778,11 @@ func (r *GithubRepository) pullRepos(ctx context.Context, branchName, repoPath,
 	}
 
 	zap.L().Info(fmt.Sprintf(
-		"downloaded %d files from branch '%s' at commit '%s' into buffer directory '%s/%s'",
+		"downloaded %d files from branch '%s' at commit '%s' into buffer directory '%s'",
 		len(tree.Entries),
 		branchName,
 		commit,
-		r.bufferDirectory,
-		r.cfg.Repo,
+		repoPath,
 	))
 
 	errCh := make(chan error, 1)
@@ -232,7 +796,7 @@ func (r *GithubRepository) pullRepos(ctx context.Context, branchName, repoPath,
 		}
 
 		wg.Add(1)
-		go r.createFile(cancelCtx, entry, repoPath, errCh, cancel, wg)
+		go r.createFile(cancelCtx, entry, repoPath, commit, errCh, cancel, wg)
 	}
 
 	go func() {
@@ -248,20 +812,28 @@ func (r *GithubRepository) pullRepos(ctx context.Context, branchName, repoPath,
 	return nil
 }
 
-func (r *GithubRepository) createImage(ctx context.Context, pipeline config.BranchPipeline, repoPath string) (io.ReadCloser, error) {
+func (r *GithubRepository) createImage(ctx context.Context, run *db.Run, pipeline config.BranchPipeline, repoPath string, log io.Writer) (string, error) {
 	dockerfileName := getRandomString()
 	imageTag := getRandomString()
+	if run.Tag != "" {
+		imageTag = tagImage(r.cfg.Repo, run.Tag)
+	}
 
 	dockerfileDst := filepath.Join(repoPath, dockerfileName)
 
-	dockerfileContent, err := os.ReadFile(pipeline.DockerFilePath)
+	dockerfileSrc := pipeline.DockerFilePath
+	if pipeline.FromRepository() {
+		dockerfileSrc = filepath.Join(repoPath, pipeline.DockerFilePath)
+	}
+
+	dockerfileContent, err := os.ReadFile(dockerfileSrc)
 	if err != nil {
 		zap.L().Error(err.Error())
-		return nil, err
+		return "", err
 	}
 	if err = os.WriteFile(dockerfileDst, dockerfileContent, 0644); err != nil {
 		zap.L().Error(err.Error())
-		return nil, err
+		return "", err
 	}
 
 	dockerCli, err := client.NewClientWithOpts(
@@ -270,7 +842,7 @@ func (r *GithubRepository) createImage(ctx context.Context, pipeline config.Bran
 	)
 	if err != nil {
 		zap.L().Error(err.Error())
-		return nil, err
+		return "", err
 	}
 	defer func() {
 		if err = dockerCli.Close(); err != nil {
@@ -281,24 +853,75 @@ func (r *GithubRepository) createImage(ctx context.Context, pipeline config.Bran
 	buildContext, err := r.getImageBuildContext(ctx, repoPath)
 	if err != nil {
 		zap.L().Error(err.Error())
-		return nil, err
+		return "", err
+	}
+
+	authConfigs, err := r.registryAuthConfigs(pipeline)
+	if err != nil {
+		zap.L().Error(err.Error())
+		return "", err
+	}
+
+	// Version variables of tags are available to the Dockerfile as build arguments.
+	buildArgs := make(map[string]*string)
+	for name, value := range deploy.VersionVariables(run.Tag) {
+		buildArgs[name] = &value
 	}
 
 	imageBuildResp, err := dockerCli.ImageBuild(
 		ctx,
 		buildContext,
 		build.ImageBuildOptions{
-			Dockerfile: filepath.Base(dockerfileDst),
-			Tags:       []string{imageTag},
-			Remove:     true,
+			Dockerfile:  filepath.Base(dockerfileDst),
+			Tags:        []string{imageTag},
+			Remove:      true,
+			AuthConfigs: authConfigs,
+			BuildArgs:   buildArgs,
 		},
 	)
 	if err != nil {
 		zap.L().Error(err.Error())
-		return nil, err
+		return "", err
 	}
 
-	return imageBuildResp.Body, nil
+	defer func() {
+		if err = imageBuildResp.Body.Close(); err != nil {
+			zap.L().Error(err.Error())
+		}
+	}()
+
+	// The build runs while its output is read, errors are reported inside the stream.
+	if err = jsonmessage.DisplayJSONMessagesStream(imageBuildResp.Body, log, 0, false, nil); err != nil {
+		zap.L().Error(err.Error())
+		return "", err
+	}
+
+	return imageTag, nil
+}
+
+// registryAuthConfigs returns registry logins of the pipeline keyed by registry address.
+func (r *GithubRepository) registryAuthConfigs(pipeline config.BranchPipeline) (map[string]registry.AuthConfig, error) {
+	authConfigs := make(map[string]registry.AuthConfig, len(pipeline.RegistryCredentials))
+
+	for _, name := range pipeline.RegistryCredentials {
+		cred, ok := r.credentials[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", config.ErrCredentialNotFound, name)
+		}
+
+		basicCred, err := cred.CredentialBasic()
+		if err != nil {
+			return nil, err
+		}
+
+		authConfigs[basicCred.Registry] = registry.AuthConfig{
+			Username:      basicCred.Username,
+			Password:      basicCred.Password,
+			ServerAddress: basicCred.Registry,
+		}
+	}
+
+	return authConfigs, nil
 }
 
 func (r *GithubRepository) getImageBuildContext(ctx context.Context, repoPath string) (io.Reader, error) {
@@ -354,6 +977,12 @@ func (r *GithubRepository) getImageBuildContext(ctx context.Context, repoPath st
 	return bytes.NewReader(buf.Bytes()), nil
 }
 
+// workspace returns the buffer directory the files of the run are downloaded to.
+// Runs of one branch may execute at the same time, and branch names may contain slashes.
+func (r *GithubRepository) workspace(run *db.Run) string {
+	return filepath.Join(r.bufferDirectory, fmt.Sprintf("%s_%s_%d", r.cfg.Owner, r.cfg.Repo, run.ID))
+}
+
 func (r *GithubRepository) clearDirectory(path string) {
 	if err := os.RemoveAll(path); err != nil {
 		zap.L().Error(fmt.Sprintf("Failed to remove buffer repository directory '%s': %v", path, err))
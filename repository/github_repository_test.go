@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"context"
+	"home-ci-cd/config"
+	"home-ci-cd/db"
+	"path/filepath"
+	"testing"
+)
+
+func TestIsRepoNewVersion_HoldsFailedCommits(t *testing.T) {
+	database, err := db.NewBoltDB(filepath.Join(t.TempDir(), "test.db"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = database.Close() })
+
+	r := &GithubRepository{cfg: config.Repository{Owner: "owner", Repo: "repo"}, db: database}
+	ctx := context.Background()
+	pipeline := config.BranchPipeline{Template: "main"}
+
+	for commit, status := range map[string]db.RunStatus{
+		"failed":      db.RunStatusFailed,
+		"timedOut":    db.RunStatusTimedOut,
+		"rolledBack":  db.RunStatusRolledBack,
+		"interrupted": db.RunStatusInterrupted,
+	} {
+		run := &db.Run{Owner: "owner", Repo: "repo", Branch: "main", Pipeline: "main", Commit: commit, Status: status}
+		if err := database.SaveRun(ctx, run); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		commit      string
+		retryFailed bool
+		want        bool
+	}{
+		{"new", false, true},
+		{"failed", false, false},
+		{"timedOut", false, false},
+		{"rolledBack", false, false},
+		{"interrupted", false, true},
+		{"failed", true, true},
+		{"rolledBack", true, true},
+	}
+	for _, tt := range tests {
+		pipeline.RetryFailed = tt.retryFailed
+		got, err := r.isRepoNewVersion(ctx, tt.commit, "main", pipeline)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("isRepoNewVersion(%q, retryFailed %v) = %v, want %v", tt.commit, tt.retryFailed, got, tt.want)
+		}
+	}
+}
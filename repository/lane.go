@@ -0,0 +1,185 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"home-ci-cd/config"
+	"home-ci-cd/db"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// lane serializes runs of one branch pipeline. It holds at most one running
+// and one pending run, a newer commit replaces the pending run.
+type lane struct {
+	running *laneRun
+	pending *laneRun
+}
+
+type laneRun struct {
+	run      *db.Run
+	pipeline config.BranchPipeline
+	ctx      context.Context
+	cancel   context.CancelCauseFunc
+	// Unregisters cancellation by Shutdown
+	stop func() bool
+	// Closed when the run finished or was superseded, err is set before
+	done chan struct{}
+	err  error
+}
+
+func laneKey(branchName string, pipeline config.BranchPipeline) string {
+	return branchName + "\x00" + pipeline.Template
+}
+
+// enqueue records the run of the branch and commit as pending and starts it once the lane is free.
+// A run of a commit already running or pending in the lane is ignored and nil is returned, unless it was triggered
+// manually or is a rollback.
+// A scheduled run thus never supersedes or cancels a run of the same commit.
+func (r *GithubRepository) enqueue(ctx context.Context, run *db.Run, pipeline config.BranchPipeline) (*laneRun, error) {
+	r.lanesMu.Lock()
+	defer r.lanesMu.Unlock()
+
+	if r.closed {
+		return nil, ErrInterrupted
+	}
+
+	key := laneKey(run.Branch, pipeline)
+	l, ok := r.lanes[key]
+	if !ok {
+		l = &lane{}
+		r.lanes[key] = l
+	}
+
+	// Manual runs build the commit again, rollbacks deploy it again.
+	if run.Trigger != db.RunTriggerManual && run.Trigger != db.RunTriggerRollback {
+		for _, lr := range []*laneRun{l.running, l.pending} {
+			if lr != nil && lr.run.Commit == run.Commit {
+				zap.L().Info(fmt.Sprintf("Commit '%s' of branch '%s' is already queued, skipping", run.Commit, run.Branch))
+				return nil, nil
+			}
+		}
+	}
+
+	run.Owner = r.cfg.Owner
+	run.Repo = r.cfg.Repo
+	run.Pipeline = pipeline.Template
+	run.Status = db.RunStatusPending
+	run.StartedAt = time.Now()
+	if err := r.db.SaveRun(ctx, run); err != nil {
+		zap.L().Error(err.Error())
+		if l.running == nil {
+			delete(r.lanes, key)
+		}
+		return nil, err
+	}
+
+	runCtx, cancel := context.WithCancelCause(ctx)
+	stop := context.AfterFunc(r.runsCtx, func() {
+		cancel(context.Cause(r.runsCtx))
+	})
+	lr := &laneRun{
+		run:      run,
+		pipeline: pipeline,
+		ctx:      runCtx,
+		cancel:   cancel,
+		stop:     stop,
+		done:     make(chan struct{}),
+	}
+
+	if l.running == nil {
+		l.running = lr
+		r.workers.Add(1)
+		go r.work(key, lr)
+		return lr, nil
+	}
+
+	if l.pending != nil {
+		zap.L().Info(fmt.Sprintf("Pending run %d of branch '%s' is superseded", l.pending.run.ID, run.Branch))
+		r.dropPending(l.pending, db.RunStatusSuperseded, ErrSuperseded)
+	}
+	l.pending = lr
+
+	if pipeline.CancelSuperseded {
+		zap.L().Info(fmt.Sprintf(
+			"Canceling run %d of branch '%s' superseded by commit '%s'",
+			l.running.run.ID,
+			run.Branch,
+			run.Commit,
+		))
+		l.running.cancel(ErrSuperseded)
+	}
+
+	return lr, nil
+}
+
+// dropPending records a pending run that will never start. Must be called with lanesMu held.
+func (r *GithubRepository) dropPending(lr *laneRun, status db.RunStatus, cause error) {
+	lr.stop()
+	lr.cancel(cause)
+	lr.run.Status = status
+	lr.run.Error = cause.Error()
+	lr.run.FinishedAt = time.Now()
+	lr.err = cause
+	if err := r.db.SaveRun(context.WithoutCancel(lr.ctx), lr.run); err != nil {
+		zap.L().Error(err.Error())
+	}
+	close(lr.done)
+}
+
+// work executes the run and then the pending run of the lane, if any.
+func (r *GithubRepository) work(key string, lr *laneRun) {
+	defer r.workers.Done()
+
+	for lr != nil {
+		lr.err = r.execRun(lr.ctx, lr.run, lr.pipeline)
+		lr.stop()
+		lr.cancel(nil)
+		close(lr.done)
+
+		r.lanesMu.Lock()
+		l := r.lanes[key]
+		lr, l.pending = l.pending, nil
+		l.running = lr
+		if lr == nil {
+			delete(r.lanes, key)
+		}
+		r.lanesMu.Unlock()
+	}
+}
+
+func (r *GithubRepository) Shutdown(ctx context.Context) {
+	r.lanesMu.Lock()
+	r.closed = true
+	for _, l := range r.lanes {
+		if l.pending != nil {
+			r.dropPending(l.pending, db.RunStatusInterrupted, ErrInterrupted)
+			l.pending = nil
+		}
+	}
+	r.lanesMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		r.workers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return
+	case <-ctx.Done():
+	}
+
+	zap.L().Warn(fmt.Sprintf("Canceling active runs of %s/%s", r.cfg.Owner, r.cfg.Repo))
+	r.cancelRuns(ErrInterrupted)
+	<-done
+}
+
+func (r *GithubRepository) isClosed() bool {
+	r.lanesMu.Lock()
+	defer r.lanesMu.Unlock()
+
+	return r.closed
+}
@@ -0,0 +1,343 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"home-ci-cd/config"
+	"home-ci-cd/db"
+	"home-ci-cd/scheduler"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const laneTestTimeout = 5 * time.Second
+
+// laneGithub serves commit statuses and holds the download of a commit until it is released,
+// after which the download fails and so does the run.
+type laneGithub struct {
+	started chan string
+
+	mu       sync.Mutex
+	released map[string]chan struct{}
+}
+
+func (g *laneGithub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.Contains(r.URL.Path, "/git/trees/") {
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{}`))
+		return
+	}
+
+	commit := path.Base(r.URL.Path)
+	g.started <- commit
+	select {
+	case <-g.releaseCh(commit):
+	case <-r.Context().Done():
+	}
+	w.WriteHeader(http.StatusNotFound)
+}
+
+func (g *laneGithub) releaseCh(commit string) chan struct{} {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	ch, ok := g.released[commit]
+	if !ok {
+		ch = make(chan struct{})
+		g.released[commit] = ch
+	}
+
+	return ch
+}
+
+func (g *laneGithub) release(commit string) {
+	close(g.releaseCh(commit))
+}
+
+// waitStarted waits until the run of the commit starts downloading files.
+func (g *laneGithub) waitStarted(t *testing.T, commit string) {
+	t.Helper()
+
+	select {
+	case got := <-g.started:
+		if got != commit {
+			t.Fatalf("started commit %q, want %q", got, commit)
+		}
+	case <-time.After(laneTestTimeout):
+		t.Fatalf("commit %q did not start", commit)
+	}
+}
+
+func (g *laneGithub) assertIdle(t *testing.T) {
+	t.Helper()
+
+	select {
+	case got := <-g.started:
+		t.Fatalf("unexpected start of commit %q", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func newLaneTestRepository(t *testing.T) (*GithubRepository, *laneGithub, db.DB) {
+	t.Helper()
+
+	github := &laneGithub{started: make(chan string, 10), released: make(map[string]chan struct{})}
+	srv := httptest.NewServer(github)
+	t.Cleanup(srv.Close)
+
+	database, err := db.NewBoltDB(filepath.Join(t.TempDir(), "test.db"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = database.Close() })
+
+	r := NewGithubRepository(
+		NewGithubClient(GithubEndpoint{BaseURL: srv.URL, Transport: http.DefaultTransport}, "token"),
+		config.Repository{Owner: "owner", Repo: "repo"},
+		nil,
+		nil,
+		scheduler.NewScheduler(config.Concurrency{Workers: 4}),
+		nil,
+		config.Server{},
+		t.TempDir(),
+		database,
+	)
+	t.Cleanup(func() {
+		r.cancelRuns(ErrInterrupted)
+		r.workers.Wait()
+	})
+
+	return r, github, database
+}
+
+func waitDone(t *testing.T, lr *laneRun) {
+	t.Helper()
+
+	select {
+	case <-lr.done:
+	case <-time.After(laneTestTimeout):
+		t.Fatalf("run %d did not finish", lr.run.ID)
+	}
+}
+
+func assertRunStatus(t *testing.T, database db.DB, id uint64, want db.RunStatus) {
+	t.Helper()
+
+	run, err := database.GetRun(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.Status != want {
+		t.Fatalf("run %d has status %q, want %q", id, run.Status, want)
+	}
+}
+
+func TestEnqueue_DedupesQueuedCommit(t *testing.T) {
+	r, github, database := newLaneTestRepository(t)
+	ctx := context.Background()
+	pipeline := config.BranchPipeline{Template: "main"}
+
+	first, err := r.enqueue(ctx, &db.Run{Branch: "main", Commit: "a1", Trigger: db.RunTriggerPush}, pipeline)
+	if err != nil || first == nil {
+		t.Fatalf("enqueue() = %v, %v", first, err)
+	}
+	github.waitStarted(t, "a1")
+
+	if lr, err := r.enqueue(ctx, &db.Run{Branch: "main", Commit: "a1", Trigger: db.RunTriggerPush}, pipeline); lr != nil || err != nil {
+		t.Fatalf("push of a running commit must be ignored, got %v, %v", lr, err)
+	}
+
+	manual, err := r.enqueue(ctx, &db.Run{Branch: "main", Commit: "a1", Trigger: db.RunTriggerManual}, pipeline)
+	if err != nil || manual == nil {
+		t.Fatalf("manual run of a running commit must be queued, got %v, %v", manual, err)
+	}
+	assertRunStatus(t, database, manual.run.ID, db.RunStatusPending)
+
+	github.release("a1")
+	waitDone(t, first)
+	github.waitStarted(t, "a1")
+	waitDone(t, manual)
+
+	assertRunStatus(t, database, first.run.ID, db.RunStatusFailed)
+	assertRunStatus(t, database, manual.run.ID, db.RunStatusFailed)
+}
+
+func TestEnqueue_SupersedesPending(t *testing.T) {
+	r, github, database := newLaneTestRepository(t)
+	ctx := context.Background()
+	pipeline := config.BranchPipeline{Template: "main"}
+
+	running, _ := r.enqueue(ctx, &db.Run{Branch: "main", Commit: "a1", Trigger: db.RunTriggerPush}, pipeline)
+	github.waitStarted(t, "a1")
+	superseded, _ := r.enqueue(ctx, &db.Run{Branch: "main", Commit: "b2", Trigger: db.RunTriggerPush}, pipeline)
+	latest, _ := r.enqueue(ctx, &db.Run{Branch: "main", Commit: "c3", Trigger: db.RunTriggerPush}, pipeline)
+
+	waitDone(t, superseded)
+	if !errors.Is(superseded.err, ErrSuperseded) {
+		t.Fatalf("superseded run error = %v, want %v", superseded.err, ErrSuperseded)
+	}
+	assertRunStatus(t, database, superseded.run.ID, db.RunStatusSuperseded)
+	if running.ctx.Err() != nil {
+		t.Fatalf("running run must not be canceled without cancelSuperseded")
+	}
+
+	// Another pipeline of the branch has its own lane.
+	other, _ := r.enqueue(ctx, &db.Run{Branch: "main", Commit: "d4", Trigger: db.RunTriggerPush}, config.BranchPipeline{Template: "docs"})
+	github.waitStarted(t, "d4")
+	github.release("d4")
+	waitDone(t, other)
+
+	github.release("a1")
+	waitDone(t, running)
+	github.waitStarted(t, "c3")
+	github.release("c3")
+	waitDone(t, latest)
+	github.assertIdle(t)
+}
+
+func TestEnqueue_CancelsSupersededRun(t *testing.T) {
+	r, github, database := newLaneTestRepository(t)
+	ctx := context.Background()
+	pipeline := config.BranchPipeline{Template: "main", CancelSuperseded: true}
+
+	running, _ := r.enqueue(ctx, &db.Run{Branch: "main", Commit: "a1", Trigger: db.RunTriggerPush}, pipeline)
+	github.waitStarted(t, "a1")
+	latest, _ := r.enqueue(ctx, &db.Run{Branch: "main", Commit: "b2", Trigger: db.RunTriggerPush}, pipeline)
+
+	waitDone(t, running)
+	assertRunStatus(t, database, running.run.ID, db.RunStatusSuperseded)
+
+	github.waitStarted(t, "b2")
+	github.release("b2")
+	waitDone(t, latest)
+	assertRunStatus(t, database, latest.run.ID, db.RunStatusFailed)
+}
+
+func TestShutdown_InterruptsRuns(t *testing.T) {
+	r, github, database := newLaneTestRepository(t)
+	ctx := context.Background()
+	pipeline := config.BranchPipeline{Template: "main"}
+
+	running, _ := r.enqueue(ctx, &db.Run{Branch: "main", Commit: "a1", Trigger: db.RunTriggerPush}, pipeline)
+	github.waitStarted(t, "a1")
+	pending, _ := r.enqueue(ctx, &db.Run{Branch: "main", Commit: "b2", Trigger: db.RunTriggerPush}, pipeline)
+
+	// Files downloaded before the shutdown.
+	workspace := r.workspace(running.run)
+	if err := os.MkdirAll(workspace, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(workspace, "main.go"), []byte("package main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	r.Shutdown(shutdownCtx)
+
+	if !isDone(running) || !isDone(pending) {
+		t.Fatalf("Shutdown returned before runs finished")
+	}
+	assertRunStatus(t, database, running.run.ID, db.RunStatusInterrupted)
+	assertRunStatus(t, database, pending.run.ID, db.RunStatusInterrupted)
+	if _, err := os.Stat(workspace); !os.IsNotExist(err) {
+		t.Fatalf("workspace %s was not removed: %v", workspace, err)
+	}
+
+	if _, err := r.enqueue(ctx, &db.Run{Branch: "main", Commit: "c3", Trigger: db.RunTriggerPush}, pipeline); !errors.Is(err, ErrInterrupted) {
+		t.Fatalf("enqueue() after Shutdown error = %v, want %v", err, ErrInterrupted)
+	}
+	github.assertIdle(t)
+}
+
+func isDone(lr *laneRun) bool {
+	select {
+	case <-lr.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestEnqueue_ScheduledRunKeepsQueuedCommit(t *testing.T) {
+	r, github, database := newLaneTestRepository(t)
+	ctx := context.Background()
+	pipeline := config.BranchPipeline{Template: "main", CancelSuperseded: true}
+
+	running, _ := r.enqueue(ctx, &db.Run{Branch: "main", Commit: "a1", Trigger: db.RunTriggerPush}, pipeline)
+	github.waitStarted(t, "a1")
+
+	if lr, err := r.enqueue(ctx, &db.Run{Branch: "main", Commit: "a1", Trigger: db.RunTriggerSchedule}, pipeline); lr != nil || err != nil {
+		t.Fatalf("scheduled run of the running commit must be ignored, got %v, %v", lr, err)
+	}
+	if running.ctx.Err() != nil {
+		t.Fatalf("scheduled run canceled the running run of its commit")
+	}
+
+	// Without cancelSuperseded a newer commit waits.
+	pipeline.CancelSuperseded = false
+	pending, _ := r.enqueue(ctx, &db.Run{Branch: "main", Commit: "b2", Trigger: db.RunTriggerPush}, pipeline)
+	if lr, err := r.enqueue(ctx, &db.Run{Branch: "main", Commit: "b2", Trigger: db.RunTriggerSchedule}, pipeline); lr != nil || err != nil {
+		t.Fatalf("scheduled run of the pending commit must be ignored, got %v, %v", lr, err)
+	}
+	assertRunStatus(t, database, pending.run.ID, db.RunStatusPending)
+
+	github.release("a1")
+	waitDone(t, running)
+	github.waitStarted(t, "b2")
+	github.release("b2")
+	waitDone(t, pending)
+	assertRunStatus(t, database, running.run.ID, db.RunStatusFailed)
+	assertRunStatus(t, database, pending.run.ID, db.RunStatusFailed)
+	github.assertIdle(t)
+}
+
+func TestRollback_WaitsInLane(t *testing.T) {
+	r, github, database := newLaneTestRepository(t)
+	ctx := context.Background()
+	pipeline := config.BranchPipeline{Template: "main", Environment: "production"}
+
+	running, _ := r.enqueue(ctx, &db.Run{Branch: "main", Commit: "b2", Trigger: db.RunTriggerPush}, pipeline)
+	github.waitStarted(t, "b2")
+
+	type result struct {
+		run db.Run
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		run, err := r.Rollback(ctx, pipeline, db.Run{Branch: "main", Commit: "a1", ImageTag: "repo:a1"}, "b2")
+		done <- result{run, err}
+	}()
+
+	select {
+	case res := <-done:
+		t.Fatalf("rollback finished next to the running run: %+v, %v", res.run, res.err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	github.release("b2")
+	waitDone(t, running)
+
+	select {
+	case res := <-done:
+		// The environment is not configured, so the deploy fails without building anything.
+		if !errors.Is(res.err, config.ErrEnvironmentNotFound) {
+			t.Fatalf("rollback error = %v, want %v", res.err, config.ErrEnvironmentNotFound)
+		}
+		if res.run.Trigger != db.RunTriggerRollback || res.run.RolledBackFrom != "b2" || res.run.Pipeline != "main" {
+			t.Fatalf("unexpected rollback run %+v", res.run)
+		}
+		assertRunStatus(t, database, res.run.ID, db.RunStatusFailed)
+	case <-time.After(laneTestTimeout):
+		t.Fatal("rollback did not finish")
+	}
+	github.assertIdle(t)
+}
@@ -6,29 +6,120 @@ import (
 	"fmt"
 	"home-ci-cd/config"
 	"home-ci-cd/db"
+	"home-ci-cd/notify"
 	"home-ci-cd/pkg"
+	"home-ci-cd/scheduler"
+	"maps"
 	"net/http"
+	"slices"
 	"sync"
 
-	"github.com/google/go-github/v81/github"
 	"go.uber.org/zap"
 )
 
 type Manager struct {
-	githubClient    *github.Client
+	githubClient *GithubClient
+	// Clients authenticated with token credentials, by credential name
+	tokenClients map[string]*GithubClient
+	// GitHub Apps of githubApp credentials, by credential name
+	apps         map[string]*GithubApp
+	appClientsMu sync.Mutex
+	// Clients authenticated as app installations, by credential name and owner
+	appClients      map[string]*GithubClient
 	repositories    []config.Repository
+	credentials     map[string]config.Credential
+	environments    map[string]config.Environment
+	scheduler       *scheduler.Scheduler
+	notifier        *notify.Notifier
+	logServer       config.Server
 	bufferDirectory string
 	db              db.DB
+
+	instancesMu sync.Mutex
+	// Created repositories, by owner/repo, so their runs can be shut down
+	instances map[string]Repository
 }
 
-func NewManager(cfg config.Git, bufferDirectory string, database db.DB) *Manager {
+func NewManager(cfg config.Config, database db.DB) (*Manager, error) {
+	endpoint, err := NewGithubEndpoint(cfg.Git.Github)
+	if err != nil {
+		zap.L().Error(err.Error())
+		return nil, err
+	}
+
+	notifier, err := notify.NewNotifier(cfg.Notifications)
+	if err != nil {
+		zap.L().Error(err.Error())
+		return nil, err
+	}
+
 	m := &Manager{
-		githubClient:    github.NewClient(nil).WithAuthToken(cfg.Github.Token),
-		bufferDirectory: bufferDirectory,
+		githubClient:    NewGithubClient(endpoint, cfg.Git.Github.Token),
+		tokenClients:    make(map[string]*GithubClient),
+		apps:            make(map[string]*GithubApp),
+		appClients:      make(map[string]*GithubClient),
+		credentials:     cfg.Credentials,
+		environments:    cfg.Environments,
+		scheduler:       scheduler.NewScheduler(cfg.Concurrency),
+		notifier:        notifier,
+		logServer:       cfg.Server,
+		bufferDirectory: cfg.BufferDirectory,
 		db:              database,
+		instances:       make(map[string]Repository),
+	}
+
+	for name, cred := range cfg.Credentials {
+		switch cred.Type {
+		case config.CredentialTokenType:
+			tokenCred, err := cred.CredentialToken()
+			if err != nil {
+				zap.L().Error(err.Error())
+				continue
+			}
+			m.tokenClients[name] = NewGithubClient(endpoint, tokenCred.Token)
+		case config.CredentialAppType:
+			appCred, err := cred.CredentialGithubApp()
+			if err != nil {
+				zap.L().Error(err.Error())
+				continue
+			}
+			app, err := NewGithubApp(endpoint, appCred)
+			if err != nil {
+				zap.L().Error(err.Error())
+				continue
+			}
+			m.apps[name] = app
+		}
+	}
+
+	return m, nil
+}
+
+// clientFor returns the client authenticated with the credential of the repository.
+func (m *Manager) clientFor(repository config.Repository) (*GithubClient, error) {
+	if repository.Credential == "" {
+		return m.githubClient, nil
+	}
+
+	if app, ok := m.apps[repository.Credential]; ok {
+		m.appClientsMu.Lock()
+		defer m.appClientsMu.Unlock()
+
+		key := repository.Credential + "/" + repository.Owner
+		client, ok := m.appClients[key]
+		if !ok {
+			client = NewGithubAppClient(app, repository.Owner)
+			m.appClients[key] = client
+		}
+		return client, nil
+	}
+
+	client, ok := m.tokenClients[repository.Credential]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", config.ErrCredentialNotFound, repository.Credential)
 	}
 
-	return m
+	return client, nil
 }
 
 func (m *Manager) Load(ctx context.Context, repositories []config.Repository) error {
@@ -40,7 +131,7 @@ func (m *Manager) Load(ctx context.Context, repositories []config.Repository) er
 		go func(errs []error, index int) {
 			defer wg.Done()
 
-			errs[index] = m.isRepositoryAccessible(ctx, repository.Owner, repository.Repo)
+			errs[index] = m.isRepositoryAccessible(ctx, repository)
 			if errs[index] == nil {
 				zap.L().Info(fmt.Sprintf("successfully connect repository %s/%s", repository.Owner, repository.Repo))
 			}
@@ -67,9 +158,20 @@ func (m *Manager) Load(ctx context.Context, repositories []config.Repository) er
 	return nil
 }
 
-func (m *Manager) isRepositoryAccessible(ctx context.Context, owner, repo string) error {
-	_, err := pkg.RequestWithRetry[*http.Response](ctx, func(tCtx context.Context) (*http.Response, error) {
-		_, resp, err := m.githubClient.Repositories.Get(tCtx, owner, repo)
+func (m *Manager) isRepositoryAccessible(ctx context.Context, repository config.Repository) error {
+	owner, repo := repository.Owner, repository.Repo
+
+	githubClient, err := m.clientFor(repository)
+	if err != nil {
+		zap.L().Error(err.Error())
+		return err
+	}
+
+	_, err = pkg.RequestWithRetry[*http.Response](ctx, func(tCtx context.Context) (*http.Response, error) {
+		_, resp, err := githubClient.Repositories.Get(tCtx, owner, repo)
+		if resp == nil {
+			return nil, err
+		}
 		return resp.Response, err
 	}, func(retryNumber int) {
 		zap.L().Warn(fmt.Sprintf("Retrying access to repository %s/%s, attempt %d", owner, repo, retryNumber))
@@ -86,14 +188,76 @@ func (m *Manager) GetAll() ([]Repository, error) {
 	r := make([]Repository, len(m.repositories))
 
 	for i, repository := range m.repositories {
-		switch repository.Type {
-		case config.GithubType:
-			r[i] = NewGithubRepository(m.githubClient, repository, m.bufferDirectory, m.db)
-		default:
-			zap.L().Error(ErrInvalidGitType.Error())
-			return nil, ErrInvalidGitType
+		repo, err := m.newRepository(repository)
+		if err != nil {
+			return nil, err
 		}
+		r[i] = repo
+	}
+
+	return r, nil
+}
+
+// newRepository returns the repository created for the config earlier or creates it.
+func (m *Manager) newRepository(repository config.Repository) (Repository, error) {
+	m.instancesMu.Lock()
+	defer m.instancesMu.Unlock()
+
+	key := repository.Owner + "/" + repository.Repo
+	if r, ok := m.instances[key]; ok {
+		return r, nil
 	}
 
+	r, err := m.createRepository(repository)
+	if err != nil {
+		return nil, err
+	}
+	m.instances[key] = r
+
 	return r, nil
 }
+
+func (m *Manager) createRepository(repository config.Repository) (Repository, error) {
+	switch repository.Type {
+	case config.GithubType:
+		githubClient, err := m.clientFor(repository)
+		if err != nil {
+			zap.L().Error(err.Error())
+			return nil, err
+		}
+		return NewGithubRepository(githubClient, repository, m.credentials, m.environments, m.scheduler, m.notifier, m.logServer, m.bufferDirectory, m.db), nil
+	default:
+		zap.L().Error(ErrInvalidGitType.Error())
+		return nil, ErrInvalidGitType
+	}
+}
+
+func (m *Manager) Get(owner, repo string) (Repository, error) {
+	for _, repository := range m.repositories {
+		if repository.Owner != owner || repository.Repo != repo {
+			continue
+		}
+
+		return m.newRepository(repository)
+	}
+
+	return nil, ErrRepositoryNotFound
+}
+
+// Shutdown shuts down every created repository, see Repository.Shutdown.
+func (m *Manager) Shutdown(ctx context.Context) {
+	m.instancesMu.Lock()
+	instances := slices.Collect(maps.Values(m.instances))
+	m.instancesMu.Unlock()
+
+	wg := &sync.WaitGroup{}
+	for _, r := range instances {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.Shutdown(ctx)
+		}()
+	}
+
+	wg.Wait()
+}
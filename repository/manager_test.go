@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"context"
+	"encoding/pem"
+	"home-ci-cd/config"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestManager_EnterpriseServerWithCustomCA(t *testing.T) {
+	requested := ""
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = r.URL.Path
+		if r.Header.Get("Authorization") != "Bearer token" {
+			t.Errorf("unexpected authorization %q", r.Header.Get("Authorization"))
+		}
+		_, _ = w.Write([]byte(`{"name": "repo"}`))
+	}))
+	defer srv.Close()
+
+	caPath := filepath.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(caPath, caPEM, 0644); err != nil {
+		t.Fatalf("failed to write CA bundle: %v", err)
+	}
+
+	m, err := NewManager(config.Config{
+		Git: config.Git{Github: config.Github{
+			Token:    "token",
+			BaseURL:  srv.URL,
+			CABundle: caPath,
+		}},
+	}, nil)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	err = m.Load(context.Background(), []config.Repository{{Type: config.GithubType, Owner: "owner", Repo: "repo"}})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if requested != "/api/v3/repos/owner/repo" {
+		t.Fatalf("unexpected request path %q", requested)
+	}
+}
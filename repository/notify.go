@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"home-ci-cd/config"
+	"home-ci-cd/db"
+	"home-ci-cd/notify"
+	"home-ci-cd/pkg"
+	"home-ci-cd/server"
+
+	"github.com/google/go-github/v81/github"
+	"go.uber.org/zap"
+)
+
+// notifyStarted sends the started event of the run.
+func (r *GithubRepository) notifyStarted(ctx context.Context, run *db.Run, pipeline config.BranchPipeline) {
+	r.notify(ctx, run, pipeline, config.NotificationStarted)
+}
+
+// notifyFinished sends the failed, recovered or succeeded event of the finished run.
+// Superseded, interrupted and skipped runs are not reported.
+func (r *GithubRepository) notifyFinished(ctx context.Context, run *db.Run, pipeline config.BranchPipeline) {
+	switch run.Status {
+	case db.RunStatusFailed, db.RunStatusTimedOut, db.RunStatusRolledBack:
+		r.notify(ctx, run, pipeline, config.NotificationFailed)
+	case db.RunStatusSuccess:
+		r.notify(ctx, run, pipeline, config.NotificationRecovered)
+	}
+}
+
+// notify sends the event in the background when a notification rule wants it.
+// A recovered event turns into a succeeded event when the previous run of the branch did not fail.
+func (r *GithubRepository) notify(ctx context.Context, run *db.Run, pipeline config.BranchPipeline, event config.NotificationEvent) {
+	repository := r.cfg.Owner + "/" + r.cfg.Repo
+	if !r.notifier.Wants(repository, pipeline.Template, event) {
+		return
+	}
+
+	msg := notify.Message{
+		Event:      event,
+		Repository: repository,
+		Pipeline:   pipeline.Template,
+		RunID:      run.ID,
+		Branch:     run.Branch,
+		Commit:     run.Commit,
+		Error:      run.Error,
+		URL:        server.RunLogURL(r.logServer, run.ID),
+	}
+	if event != config.NotificationStarted {
+		msg.Duration = run.FinishedAt.Sub(run.StartedAt)
+	}
+
+	// Shutdown waits for notifications like for runs.
+	r.workers.Add(1)
+	go func() {
+		defer r.workers.Done()
+
+		ctx := context.WithoutCancel(ctx)
+		if event == config.NotificationRecovered && !r.previousRunFailed(ctx, run) {
+			msg.Event = config.NotificationSucceeded
+			if !r.notifier.Wants(repository, pipeline.Template, msg.Event) {
+				return
+			}
+		}
+		msg.Author = r.commitAuthor(ctx, run.Commit)
+
+		r.notifier.Notify(ctx, msg)
+	}()
+}
+
+// previousRunFailed reports whether the last finished run of the pipeline of the branch before the run failed.
+func (r *GithubRepository) previousRunFailed(ctx context.Context, run *db.Run) bool {
+	runs, err := r.db.ListRuns(ctx, db.RunFilter{
+		Owner:    r.cfg.Owner,
+		Repo:     r.cfg.Repo,
+		Branch:   run.Branch,
+		Pipeline: run.Pipeline,
+	})
+	if err != nil {
+		zap.L().Error(err.Error())
+		return false
+	}
+
+	for _, previous := range runs {
+		if previous.ID >= run.ID {
+			continue
+		}
+		switch previous.Status {
+		case db.RunStatusFailed, db.RunStatusTimedOut, db.RunStatusRolledBack:
+			return true
+		case db.RunStatusSuccess:
+			return false
+		}
+	}
+
+	return false
+}
+
+// commitAuthor returns the name of the author of the commit, empty when it cannot be read.
+func (r *GithubRepository) commitAuthor(ctx context.Context, commit string) string {
+	repoCommit, err := pkg.RequestWithRetry(ctx, func(tCtx context.Context) (*github.RepositoryCommit, error) {
+		repoCommit, _, err := r.client.Repositories.GetCommit(tCtx, r.cfg.Owner, r.cfg.Repo, commit, nil)
+		return repoCommit, err
+	}, func(retryNumber int) {
+		zap.L().Warn(fmt.Sprintf("Retrying author of commit '%s', attempt %d", commit, retryNumber))
+	})
+	if err != nil {
+		zap.L().Error(fmt.Sprintf("Failed to read author of commit '%s': %v", commit, err))
+		return ""
+	}
+
+	if name := repoCommit.GetCommit().GetAuthor().GetName(); name != "" {
+		return name
+	}
+
+	return repoCommit.GetAuthor().GetLogin()
+}
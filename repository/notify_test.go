@@ -0,0 +1,41 @@
+package repository
+
+import (
+	"context"
+	"home-ci-cd/config"
+	"home-ci-cd/db"
+	"path/filepath"
+	"testing"
+)
+
+func TestPreviousRunFailed(t *testing.T) {
+	database, err := db.NewBoltDB(filepath.Join(t.TempDir(), "test.db"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = database.Close() })
+
+	r := &GithubRepository{cfg: config.Repository{Owner: "owner", Repo: "repo"}, db: database}
+	ctx := context.Background()
+
+	runs := []*db.Run{
+		{Pipeline: "api", Status: db.RunStatusFailed},
+		{Pipeline: "web", Status: db.RunStatusSuccess},
+		{Pipeline: "api", Status: db.RunStatusSuccess},
+		{Pipeline: "web", Status: db.RunStatusSuccess},
+	}
+	for _, run := range runs {
+		run.Owner, run.Repo, run.Branch = "owner", "repo", "main"
+		if err := database.SaveRun(ctx, run); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A success of another pipeline in between does not hide the failure.
+	if !r.previousRunFailed(ctx, runs[2]) {
+		t.Fatal("expected the api run to recover from the failed api run")
+	}
+	if r.previousRunFailed(ctx, runs[3]) {
+		t.Fatal("a failed api run must not make the web run a recovery")
+	}
+}
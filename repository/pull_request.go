@@ -0,0 +1,265 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"home-ci-cd/config"
+	"home-ci-cd/db"
+	"home-ci-cd/pkg"
+	"home-ci-cd/server"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v81/github"
+	"go.uber.org/zap"
+)
+
+const (
+	// Prefix of the lane and run branch of pull request runs
+	pullRequestBranchPrefix = "pull/"
+	// Marks the comment of home-ci-cd among the comments of a pull request
+	pullRequestCommentMarker = "<!-- home-ci-cd -->"
+)
+
+func pullRequestBranch(number int) string {
+	return fmt.Sprintf("%s%d", pullRequestBranchPrefix, number)
+}
+
+func (r *GithubRepository) watchPullRequests(ctx context.Context) {
+	for {
+		r.pullRequests(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(r.client.RateLimit.Delay(watchPipelineSleepDuration)):
+		}
+	}
+}
+
+// pullRequests queues runs of open pull requests whose head was not built yet.
+func (r *GithubRepository) pullRequests(ctx context.Context) {
+	opts := &github.PullRequestListOptions{
+		State: "open",
+		ListOptions: github.ListOptions{
+			PerPage: BranchListPerPageOption,
+		},
+	}
+
+	for {
+		prs, resp, err := r.client.PullRequests.List(conditional(ctx), r.cfg.Owner, r.cfg.Repo, opts)
+		if err != nil {
+			zap.L().Error(err.Error())
+			return
+		}
+
+		for _, pr := range prs {
+			r.pullRequest(ctx, pr)
+		}
+
+		if resp.NextPage == 0 {
+			return
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+func (r *GithubRepository) pullRequest(ctx context.Context, pr *github.PullRequest) {
+	number, head := pr.GetNumber(), pr.GetHead().GetSHA()
+
+	pipeline, ok, err := r.pullRequestPipeline(pr)
+	if err != nil {
+		zap.L().Error(err.Error())
+		return
+	}
+	if !ok {
+		return
+	}
+
+	state, err := r.db.GetPullRequest(ctx, r.cfg.Owner, r.cfg.Repo, number)
+	if err != nil {
+		zap.L().Error(err.Error())
+		return
+	}
+	if state.Head == head {
+		return
+	}
+
+	if r.isFork(pr) {
+		zap.L().Info(fmt.Sprintf("Pull request #%d is from fork %s, building without secrets", number, pr.GetHead().GetRepo().GetFullName()))
+	}
+
+	run := &db.Run{
+		Branch:      pullRequestBranch(number),
+		Commit:      head,
+		Trigger:     db.RunTriggerPullRequest,
+		PullRequest: number,
+	}
+
+	if !r.cfg.SkipDirectives.Disabled {
+		commit, _, err := r.client.Git.GetCommit(ctx, r.cfg.Owner, r.cfg.Repo, head)
+		if err != nil {
+			zap.L().Error(err.Error())
+			return
+		}
+		if r.applySkipDirective(ctx, run, &pipeline, commit.GetMessage()) {
+			return
+		}
+	}
+
+	if pipeline.HasPathFilters() {
+		match, err := r.pullRequestChangesMatch(ctx, number, pipeline)
+		if err != nil {
+			zap.L().Error(err.Error())
+			return
+		}
+		if !match {
+			r.skipRun(ctx, run, pipeline, skipReasonPaths)
+			return
+		}
+	}
+
+	// Runs outlive the watch context, they are stopped by Shutdown.
+	lr, err := r.enqueue(context.WithoutCancel(ctx), run, pipeline)
+	if err != nil || lr == nil {
+		return
+	}
+
+	go func() {
+		<-lr.done
+		zap.L().Info(fmt.Sprintf(
+			"Pipeline completed for pull request #%d at commit '%s' with status '%s'",
+			number,
+			head,
+			lr.run.Status,
+		))
+	}()
+}
+
+// pullRequestPipeline returns the first pull request pipeline matching the base and head branches.
+// Pipelines of pull requests from forks have no registry credentials and no remote commands.
+func (r *GithubRepository) pullRequestPipeline(pr *github.PullRequest) (config.BranchPipeline, bool, error) {
+	fork := r.isFork(pr)
+
+	for _, prPipeline := range r.cfg.PullRequestPipelines {
+		if fork && !prPipeline.Forks {
+			continue
+		}
+
+		if prPipeline.Base != "" {
+			match, err := filepath.Match(prPipeline.Base, pr.GetBase().GetRef())
+			if err != nil {
+				return config.BranchPipeline{}, false, err
+			}
+			if !match {
+				continue
+			}
+		}
+		match, err := prPipeline.MatchBranch(pr.GetHead().GetRef())
+		if err != nil {
+			return config.BranchPipeline{}, false, err
+		}
+		if !match {
+			continue
+		}
+
+		pipeline := prPipeline.BranchPipeline
+		if pipeline.StatusContext == "" {
+			pipeline.StatusContext = statusContextPrefix + "pr/" + pipeline.Template
+		}
+		if fork {
+			pipeline.RegistryCredentials = nil
+			pipeline.Environment = ""
+			pipeline.RemoteCommands = nil
+			pipeline.HealthCheck = nil
+		}
+
+		return pipeline, true, nil
+	}
+
+	return config.BranchPipeline{}, false, nil
+}
+
+// isFork reports whether the head of the pull request lives outside the repository.
+// The head repository of a deleted fork is unknown and treated as a fork.
+func (r *GithubRepository) isFork(pr *github.PullRequest) bool {
+	repo := pr.GetHead().GetRepo()
+	return repo == nil || !strings.EqualFold(repo.GetFullName(), r.cfg.Owner+"/"+r.cfg.Repo)
+}
+
+// finishPullRequest records the built head of the pull request and reports the result in its comment.
+// Superseded and interrupted runs are not recorded, so their head is built again.
+func (r *GithubRepository) finishPullRequest(ctx context.Context, run *db.Run, pipeline config.BranchPipeline) {
+	if run.Status == db.RunStatusSuperseded || run.Status == db.RunStatusInterrupted {
+		return
+	}
+
+	state, err := r.db.GetPullRequest(ctx, r.cfg.Owner, r.cfg.Repo, run.PullRequest)
+	if err != nil {
+		zap.L().Error(err.Error())
+		return
+	}
+	state.Head = run.Commit
+	state.CommentID = r.upsertComment(ctx, run.PullRequest, state.CommentID, pullRequestComment(run, pipeline, r.logServer))
+
+	if err = r.db.SavePullRequest(ctx, state); err != nil {
+		zap.L().Error(err.Error())
+	}
+}
+
+// upsertComment edits the comment of the pull request or creates it when it does not exist yet.
+// It returns the ID of the comment, the given one when writing failed.
+func (r *GithubRepository) upsertComment(ctx context.Context, number int, commentID int64, body string) int64 {
+	comment := &github.IssueComment{Body: github.Ptr(body)}
+	retryLog := func(retryNumber int) {
+		zap.L().Warn(fmt.Sprintf("Retrying comment of pull request #%d, attempt %d", number, retryNumber))
+	}
+
+	if commentID != 0 {
+		_, err := pkg.RequestWithRetry(ctx, func(tCtx context.Context) (*github.IssueComment, error) {
+			edited, _, err := r.client.Issues.EditComment(tCtx, r.cfg.Owner, r.cfg.Repo, commentID, comment)
+			return edited, err
+		}, retryLog)
+
+		var respErr *github.ErrorResponse
+		switch {
+		case err == nil:
+			return commentID
+		case !errors.As(err, &respErr) || respErr.Response.StatusCode != http.StatusNotFound:
+			zap.L().Error(fmt.Sprintf("Failed to update comment of pull request #%d: %v", number, err))
+			return commentID
+		}
+		// The comment was deleted, a new one is created.
+	}
+
+	created, err := pkg.RequestWithRetry(ctx, func(tCtx context.Context) (*github.IssueComment, error) {
+		created, _, err := r.client.Issues.CreateComment(tCtx, r.cfg.Owner, r.cfg.Repo, number, comment)
+		return created, err
+	}, retryLog)
+	if err != nil {
+		zap.L().Error(fmt.Sprintf("Failed to comment on pull request #%d: %v", number, err))
+		return commentID
+	}
+
+	return created.GetID()
+}
+
+// pullRequestComment renders the result of the run for the pull request comment.
+func pullRequestComment(run *db.Run, pipeline config.BranchPipeline, logServer config.Server) string {
+	_, description := statusState(run)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n**`%s`**: %s\n\n", pullRequestCommentMarker, statusContext(pipeline), description)
+	fmt.Fprintf(&b, "- Commit: `%s`\n", run.Commit)
+	if run.ImageTag != "" {
+		fmt.Fprintf(&b, "- Image: `%s`\n", run.ImageTag)
+	}
+	if url := server.RunLogURL(logServer, run.ID); url != "" {
+		fmt.Fprintf(&b, "- [Run log](%s)\n", url)
+	}
+
+	return b.String()
+}
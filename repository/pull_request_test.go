@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"context"
+	"home-ci-cd/config"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-github/v81/github"
+)
+
+func TestPullRequestPipeline(t *testing.T) {
+	r := &GithubRepository{cfg: config.Repository{
+		Owner: "owner",
+		Repo:  "repo",
+		PullRequestPipelines: []config.PullRequestPipeline{
+			{
+				Base: "release/*",
+				BranchPipeline: config.BranchPipeline{
+					Template:       "*",
+					StatusContext:  "release",
+					RemoteCommands: []string{"deploy"},
+				},
+			},
+			{
+				Base:  "main",
+				Forks: true,
+				BranchPipeline: config.BranchPipeline{
+					Template:            "feature/*",
+					RegistryCredentials: []string{"registry"},
+					Environment:         "preview",
+					RemoteCommands:      []string{"deploy"},
+				},
+			},
+		},
+	}}
+
+	pr := func(base, head, headRepo string) *github.PullRequest {
+		return &github.PullRequest{
+			Base: &github.PullRequestBranch{Ref: github.Ptr(base)},
+			Head: &github.PullRequestBranch{Ref: github.Ptr(head), Repo: &github.Repository{FullName: github.Ptr(headRepo)}},
+		}
+	}
+
+	pipeline, ok, err := r.pullRequestPipeline(pr("release/1.0", "fix", "owner/repo"))
+	if err != nil || !ok || pipeline.StatusContext != "release" || len(pipeline.RemoteCommands) != 1 {
+		t.Fatalf("expected the release pipeline, got %+v, %v, %v", pipeline, ok, err)
+	}
+
+	// Forks are not built by the release pipeline.
+	if _, ok, _ = r.pullRequestPipeline(pr("release/1.0", "fix", "someone/repo")); ok {
+		t.Fatal("expected no pipeline for a fork of the release branch")
+	}
+
+	pipeline, ok, err = r.pullRequestPipeline(pr("main", "feature/login", "someone/repo"))
+	if err != nil || !ok {
+		t.Fatalf("expected the fork pipeline, got %v, %v", ok, err)
+	}
+	if pipeline.RegistryCredentials != nil || pipeline.Environment != "" || pipeline.RemoteCommands != nil {
+		t.Fatalf("fork pipeline must not use secrets, got %+v", pipeline)
+	}
+	if pipeline.StatusContext != "home-ci-cd/pr/feature/*" {
+		t.Fatalf("unexpected status context %q", pipeline.StatusContext)
+	}
+
+	if _, ok, _ = r.pullRequestPipeline(pr("main", "bugfix", "owner/repo")); ok {
+		t.Fatal("expected no pipeline for an unmatched head branch")
+	}
+}
+
+func TestUpsertComment_RecreatesDeletedComment(t *testing.T) {
+	var requests []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		if r.Method == http.MethodPatch {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"message": "Not Found"}`))
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"id": 42}`))
+	}))
+	defer srv.Close()
+
+	r := &GithubRepository{
+		cfg:    config.Repository{Owner: "owner", Repo: "repo"},
+		client: NewGithubClient(GithubEndpoint{BaseURL: srv.URL, Transport: http.DefaultTransport}, "token"),
+	}
+
+	if id := r.upsertComment(context.Background(), 5, 7, "result"); id != 42 {
+		t.Fatalf("expected the new comment, got %d", id)
+	}
+	want := []string{
+		"PATCH /api/v3/repos/owner/repo/issues/comments/7",
+		"POST /api/v3/repos/owner/repo/issues/5/comments",
+	}
+	if len(requests) != len(want) || requests[0] != want[0] || requests[1] != want[1] {
+		t.Fatalf("unexpected requests %v", requests)
+	}
+}
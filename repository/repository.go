@@ -1,7 +1,21 @@
 package repository
 
-import "context"
+import (
+	"context"
+	"home-ci-cd/config"
+	"home-ci-cd/db"
+)
 
 type Repository interface {
 	WatchBranches(ctx context.Context)
+	// Trigger runs the pipeline of the branch once for the commit.
+	Trigger(ctx context.Context, branch, commit string) (db.Run, error)
+	// Rollback redeploys the image of the target run on its branch, replacing the live commit.
+	// The rollback runs in the lane of the pipeline like any other run.
+	Rollback(ctx context.Context, pipeline config.BranchPipeline, target db.Run, liveCommit string) (db.Run, error)
+	// Pipeline returns the pipeline of the branch as defined at the commit.
+	Pipeline(ctx context.Context, branch, commit string) (config.BranchPipeline, error)
+	// Shutdown stops starting runs and waits for active runs until ctx is done,
+	// then cancels them. Runs that did not finish are recorded as interrupted.
+	Shutdown(ctx context.Context)
 }
@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"home-ci-cd/config"
+	"home-ci-cd/db"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// watchSchedule runs the pipeline for the head of the branch at every activation of its schedule.
+func (r *GithubRepository) watchSchedule(ctx context.Context, branchName string, pipeline config.BranchPipeline) {
+	schedule, err := pipeline.Schedule.CronSchedule()
+	if err != nil {
+		zap.L().Error(err.Error())
+		return
+	}
+
+	for {
+		next := schedule.Next(time.Now())
+		if next.IsZero() {
+			zap.L().Warn(fmt.Sprintf("Schedule '%s' of branch '%s' never runs", pipeline.Schedule.Cron, branchName))
+			return
+		}
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		r.scheduledRun(ctx, branchName, pipeline)
+	}
+}
+
+// scheduledRun queues a run of the branch head, even if the commit was already built.
+// Skip directives and path filters do not apply, there are no new changes to filter.
+func (r *GithubRepository) scheduledRun(ctx context.Context, branchName string, pipeline config.BranchPipeline) {
+	commit, err := r.branchHead(ctx, branchName)
+	if err != nil {
+		zap.L().Error(err.Error())
+		return
+	}
+
+	// Pipelines from the pipeline file are taken from the commit being built.
+	if pipeline.FromRepository() {
+		var ok bool
+		if pipeline, ok, err = r.pipelineForCommit(ctx, branchName, commit); err != nil {
+			zap.L().Error(err.Error())
+			return
+		}
+		if !ok || pipeline.Schedule == nil {
+			zap.L().Info(fmt.Sprintf("Branch '%s' has no scheduled pipeline at commit '%s', skipping", branchName, commit))
+			return
+		}
+	}
+
+	zap.L().Info(fmt.Sprintf("Scheduled run of branch '%s' at commit '%s'", branchName, commit))
+
+	// Runs outlive the watch context, they are stopped by Shutdown.
+	lr, err := r.enqueue(context.WithoutCancel(ctx), &db.Run{
+		Branch:  branchName,
+		Commit:  commit,
+		Trigger: db.RunTriggerSchedule,
+	}, pipeline)
+	if err != nil || lr == nil {
+		return
+	}
+
+	go func() {
+		<-lr.done
+		zap.L().Info(fmt.Sprintf(
+			"Scheduled pipeline completed for branch '%s' at commit '%s' with status '%s'",
+			branchName,
+			commit,
+			lr.run.Status,
+		))
+	}()
+}
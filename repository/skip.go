@@ -0,0 +1,222 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"home-ci-cd/config"
+	"home-ci-cd/db"
+	"home-ci-cd/pkg"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v81/github"
+	"go.uber.org/zap"
+)
+
+const (
+	skipReasonPaths = "no changed file matches the path filters"
+	// GitHub lists at most this many files of a comparison, later files are missing.
+	maxCompareFiles = 300
+)
+
+// skipDirective returns the reason to skip the run when the commit message contains a skip directive.
+// deployOnly is set when only the deploy stage is skipped.
+func (r *GithubRepository) skipDirective(message string) (reason string, deployOnly bool, ok bool) {
+	if r.cfg.SkipDirectives.Disabled {
+		return "", false, false
+	}
+
+	message = strings.ToLower(message)
+	for _, directive := range r.cfg.SkipDirectives.PipelineDirectives() {
+		if strings.Contains(message, strings.ToLower(directive)) {
+			return fmt.Sprintf("commit message contains %s", directive), false, true
+		}
+	}
+	for _, directive := range r.cfg.SkipDirectives.DeployDirectives() {
+		if strings.Contains(message, strings.ToLower(directive)) {
+			return fmt.Sprintf("deploy skipped, commit message contains %s", directive), true, true
+		}
+	}
+
+	return "", false, false
+}
+
+// applySkipDirective skips the run when the commit message asks for it and reports whether it did.
+// When only the deploy stage is skipped, the remote commands of the pipeline are removed.
+func (r *GithubRepository) applySkipDirective(ctx context.Context, run *db.Run, pipeline *config.BranchPipeline, message string) bool {
+	reason, deployOnly, ok := r.skipDirective(message)
+	if !ok {
+		return false
+	}
+	if !deployOnly {
+		r.skipRun(ctx, run, *pipeline, reason)
+		return true
+	}
+
+	run.Reason = reason
+	run.DeploySkipped = true
+	pipeline.Environment = ""
+	pipeline.RemoteCommands = nil
+	pipeline.HealthCheck = nil
+
+	return false
+}
+
+// skipRun records a run of the commit that is not executed and advances the built commit
+// of the branch or pull request, so the commit is not considered again.
+func (r *GithubRepository) skipRun(ctx context.Context, run *db.Run, pipeline config.BranchPipeline, reason string) {
+	now := time.Now()
+	run.Owner = r.cfg.Owner
+	run.Repo = r.cfg.Repo
+	run.Pipeline = pipeline.Template
+	run.Status = db.RunStatusSkipped
+	run.Reason = reason
+	run.StartedAt = now
+	run.FinishedAt = now
+
+	if err := r.db.SaveRun(ctx, run); err != nil {
+		zap.L().Error(err.Error())
+		return
+	}
+
+	log := pkg.NewLogBuffer()
+	log.Printf("Run %d of %s/%s branch '%s' at commit '%s' skipped: %s", run.ID, run.Owner, run.Repo, run.Branch, run.Commit, reason)
+	zap.L().Info(fmt.Sprintf("Skipping commit '%s' of branch '%s': %s", run.Commit, run.Branch, reason))
+	if err := r.db.SaveRunLog(ctx, run.ID, log.Bytes()); err != nil {
+		zap.L().Error(err.Error())
+	}
+
+	r.createCheckRun(ctx, run, pipeline)
+	if run.CheckRunID != 0 {
+		if err := r.db.SaveRun(ctx, run); err != nil {
+			zap.L().Error(err.Error())
+		}
+	}
+	r.completeCheckRun(ctx, run, pipeline, newRunSteps(log))
+	r.reportStatus(ctx, run, pipeline)
+
+	switch {
+	case run.PullRequest != 0:
+		state, err := r.db.GetPullRequest(ctx, r.cfg.Owner, r.cfg.Repo, run.PullRequest)
+		if err != nil {
+			zap.L().Error(err.Error())
+			return
+		}
+		state.Head = run.Commit
+		if err = r.db.SavePullRequest(ctx, state); err != nil {
+			zap.L().Error(err.Error())
+		}
+	default:
+		if err := r.db.SaveLastCommit(ctx, r.cfg.Owner, r.cfg.Repo, run.Branch, pipeline.Template, run.Commit); err != nil {
+			zap.L().Error(err.Error())
+		}
+	}
+}
+
+// branchChangesMatch reports whether files changed since the last commit of the branch built by the pipeline
+// match its path filters. Without a commit to compare with or with a truncated list of files, the changes match.
+func (r *GithubRepository) branchChangesMatch(ctx context.Context, branchName, commit string, pipeline config.BranchPipeline) (bool, error) {
+	lastCommit, err := r.db.GetLastCommit(ctx, r.cfg.Owner, r.cfg.Repo, branchName, pipeline.Template)
+	if err != nil {
+		return false, err
+	}
+	if lastCommit == "" {
+		return true, nil
+	}
+
+	var files []string
+	opts := &github.ListOptions{PerPage: BranchListPerPageOption}
+	for {
+		comparison, resp, err := r.client.Repositories.CompareCommits(ctx, r.cfg.Owner, r.cfg.Repo, lastCommit, commit, opts)
+		if err != nil {
+			// The last built commit is gone after a force push.
+			if resp != nil && resp.StatusCode == http.StatusNotFound {
+				return true, nil
+			}
+			return false, err
+		}
+		// A file matching the filters may be missing from a truncated list.
+		if len(comparison.Files) >= maxCompareFiles {
+			return true, nil
+		}
+		files = append(files, commitFileNames(comparison.Files)...)
+
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	return matchPathFilters(pipeline, files)
+}
+
+// pullRequestChangesMatch reports whether files changed by the pull request match the path filters of the pipeline.
+func (r *GithubRepository) pullRequestChangesMatch(ctx context.Context, number int, pipeline config.BranchPipeline) (bool, error) {
+	var files []string
+	opts := &github.ListOptions{PerPage: BranchListPerPageOption}
+	for {
+		page, resp, err := r.client.PullRequests.ListFiles(ctx, r.cfg.Owner, r.cfg.Repo, number, opts)
+		if err != nil {
+			return false, err
+		}
+		files = append(files, commitFileNames(page)...)
+
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	return matchPathFilters(pipeline, files)
+}
+
+// commitFileNames returns the names of the files, renamed files are included under both names.
+func commitFileNames(files []*github.CommitFile) []string {
+	names := make([]string, 0, len(files))
+	for _, file := range files {
+		names = append(names, file.GetFilename())
+		if previous := file.GetPreviousFilename(); previous != "" {
+			names = append(names, previous)
+		}
+	}
+
+	return names
+}
+
+// matchPathFilters reports whether any file matches paths, any file when paths are empty,
+// without matching pathsIgnore.
+func matchPathFilters(pipeline config.BranchPipeline, files []string) (bool, error) {
+	for _, file := range files {
+		if len(pipeline.Paths) > 0 {
+			ok, err := matchAnyPath(pipeline.Paths, file)
+			if err != nil {
+				return false, err
+			}
+			if !ok {
+				continue
+			}
+		}
+
+		ignored, err := matchAnyPath(pipeline.PathsIgnore, file)
+		if err != nil {
+			return false, err
+		}
+		if !ignored {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func matchAnyPath(patterns []string, file string) (bool, error) {
+	for _, pattern := range patterns {
+		ok, err := pkg.MatchPath(pattern, file)
+		if err != nil || ok {
+			return ok, err
+		}
+	}
+
+	return false, nil
+}
@@ -0,0 +1,171 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"home-ci-cd/config"
+	"home-ci-cd/db"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMatchPathFilters(t *testing.T) {
+	pipeline := config.BranchPipeline{
+		Paths:       []string{"services/api/**", "go.mod"},
+		PathsIgnore: []string{"**/*.md"},
+	}
+
+	tests := []struct {
+		files []string
+		want  bool
+	}{
+		{[]string{"services/api/main.go"}, true},
+		{[]string{"services/api/README.md"}, false},
+		{[]string{"docs/index.md", "services/web/main.go"}, false},
+		{[]string{"docs/index.md", "go.mod"}, true},
+		{nil, false},
+	}
+
+	for _, tt := range tests {
+		got, err := matchPathFilters(pipeline, tt.files)
+		if err != nil {
+			t.Fatalf("%v: unexpected error %v", tt.files, err)
+		}
+		if got != tt.want {
+			t.Fatalf("%v: got %v, want %v", tt.files, got, tt.want)
+		}
+	}
+}
+
+func TestBranchChangesMatch(t *testing.T) {
+	path := ""
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "/compare/") {
+			path = r.URL.Path
+		}
+		_, _ = w.Write([]byte(`{"files": [{"filename": "docs/setup.md"}, {"filename": "services/api/main.go", "previous_filename": "api/main.go"}]}`))
+	}))
+	defer srv.Close()
+
+	database, err := db.NewBoltDB(filepath.Join(t.TempDir(), "test.db"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = database.Close() })
+
+	r := &GithubRepository{
+		cfg:    config.Repository{Owner: "owner", Repo: "repo"},
+		client: NewGithubClient(GithubEndpoint{BaseURL: srv.URL, Transport: http.DefaultTransport}, "token"),
+		db:     database,
+	}
+	ctx := context.Background()
+
+	// Two pipelines of one branch, each compared with the last commit it built.
+	api := config.BranchPipeline{Template: "api", Paths: []string{"services/api/**"}}
+	web := config.BranchPipeline{Template: "web", Paths: []string{"services/web/**"}}
+
+	if err := database.SaveLastCommit(ctx, "owner", "repo", "main", api.Template, "old"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without a built commit there is nothing to compare with.
+	if match, err := r.branchChangesMatch(ctx, "main", "new", web); err != nil || !match || path != "" {
+		t.Fatalf("expected a match without a built commit, got %v, %v, %q", match, err, path)
+	}
+
+	if match, err := r.branchChangesMatch(ctx, "main", "new", api); err != nil || !match {
+		t.Fatalf("expected api changes to match, got %v, %v", match, err)
+	}
+	if path != "/api/v3/repos/owner/repo/compare/old...new" {
+		t.Fatalf("unexpected path %q", path)
+	}
+
+	// Skipping the web pipeline advances its commit only.
+	r.skipRun(ctx, &db.Run{Branch: "main", Commit: "new", Trigger: db.RunTriggerPush}, web, skipReasonPaths)
+	for template, want := range map[string]string{api.Template: "old", web.Template: "new"} {
+		if commit, err := database.GetLastCommit(ctx, "owner", "repo", "main", template); err != nil || commit != want {
+			t.Fatalf("%s: last commit %q, %v, want %q", template, commit, err, want)
+		}
+	}
+
+	if match, err := r.branchChangesMatch(ctx, "main", "newer", web); err != nil || match {
+		t.Fatalf("expected web changes not to match, got %v, %v", match, err)
+	}
+	if path != "/api/v3/repos/owner/repo/compare/new...newer" {
+		t.Fatalf("unexpected path %q", path)
+	}
+	if match, err := r.branchChangesMatch(ctx, "main", "newer", api); err != nil || !match {
+		t.Fatalf("expected api changes to match, got %v, %v", match, err)
+	}
+	if path != "/api/v3/repos/owner/repo/compare/old...newer" {
+		t.Fatalf("unexpected path %q", path)
+	}
+}
+
+func TestBranchChangesMatch_TruncatedFiles(t *testing.T) {
+	files := make([]string, maxCompareFiles)
+	for i := range files {
+		files[i] = fmt.Sprintf(`{"filename": "docs/page%d.md"}`, i)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"files": [` + strings.Join(files, ",") + `]}`))
+	}))
+	defer srv.Close()
+
+	database, err := db.NewBoltDB(filepath.Join(t.TempDir(), "test.db"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = database.Close() })
+
+	r := &GithubRepository{
+		cfg:    config.Repository{Owner: "owner", Repo: "repo"},
+		client: NewGithubClient(GithubEndpoint{BaseURL: srv.URL, Transport: http.DefaultTransport}, "token"),
+		db:     database,
+	}
+	ctx := context.Background()
+	api := config.BranchPipeline{Template: "api", Paths: []string{"services/api/**"}}
+
+	if err := database.SaveLastCommit(ctx, "owner", "repo", "main", api.Template, "old"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A changed api file may be beyond the files GitHub lists.
+	if match, err := r.branchChangesMatch(ctx, "main", "new", api); err != nil || !match {
+		t.Fatalf("expected a truncated comparison to match, got %v, %v", match, err)
+	}
+}
+
+func TestSkipDirective(t *testing.T) {
+	r := &GithubRepository{}
+
+	tests := []struct {
+		message    string
+		reason     string
+		deployOnly bool
+		ok         bool
+	}{
+		{"Fix typo [skip ci]", "commit message contains [skip ci]", false, true},
+		{"Update docs\n\n[CI SKIP]", "commit message contains [ci skip]", false, true},
+		{"Bump version [skip deploy]", "deploy skipped, commit message contains [skip deploy]", true, true},
+		{"Add feature", "", false, false},
+	}
+
+	for _, tt := range tests {
+		reason, deployOnly, ok := r.skipDirective(tt.message)
+		if reason != tt.reason || deployOnly != tt.deployOnly || ok != tt.ok {
+			t.Fatalf("%q: got %q %v %v", tt.message, reason, deployOnly, ok)
+		}
+	}
+
+	r.cfg.SkipDirectives = config.SkipDirectives{Pipeline: []string{"[no build]"}}
+	if _, _, ok := r.skipDirective("Fix typo [skip ci]"); ok {
+		t.Fatal("configured directives must replace the defaults")
+	}
+	if _, _, ok := r.skipDirective("Fix typo [no build]"); !ok {
+		t.Fatal("expected the configured directive to skip the run")
+	}
+}
@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"home-ci-cd/config"
+	"home-ci-cd/db"
+	"home-ci-cd/pkg"
+	"home-ci-cd/server"
+
+	"github.com/google/go-github/v81/github"
+	"go.uber.org/zap"
+)
+
+const (
+	statusContextPrefix = "home-ci-cd/"
+	// GitHub limits status descriptions to 140 characters.
+	maxStatusDescription = 140
+)
+
+// Commit status states accepted by GitHub.
+const (
+	statusPending = "pending"
+	statusSuccess = "success"
+	statusFailure = "failure"
+	statusError   = "error"
+)
+
+// statusContext returns the commit status context of the pipeline.
+func statusContext(pipeline config.BranchPipeline) string {
+	if pipeline.StatusContext != "" {
+		return pipeline.StatusContext
+	}
+
+	return statusContextPrefix + pipeline.Template
+}
+
+// statusState maps the status of a run to a commit status state and description.
+func statusState(run *db.Run) (string, string) {
+	switch run.Status {
+	case db.RunStatusPending, db.RunStatusRunning:
+		return statusPending, fmt.Sprintf("Run %d is in progress", run.ID)
+	case db.RunStatusSuccess:
+		return statusSuccess, fmt.Sprintf("Run %d succeeded", run.ID)
+	case db.RunStatusFailed:
+		return statusFailure, truncate(fmt.Sprintf("Run %d failed: %s", run.ID, pkg.Redact(run.Error)), maxStatusDescription)
+	case db.RunStatusRolledBack:
+		return statusFailure, fmt.Sprintf("Run %d failed the health check and was rolled back", run.ID)
+	case db.RunStatusSkipped:
+		return statusSuccess, truncate(fmt.Sprintf("Run %d skipped: %s", run.ID, run.Reason), maxStatusDescription)
+	// The commit did not fail, it waits for a newer run or the next poll.
+	case db.RunStatusSuperseded:
+		return statusPending, fmt.Sprintf("Run %d was superseded by a newer commit", run.ID)
+	case db.RunStatusInterrupted:
+		return statusPending, fmt.Sprintf("Run %d was interrupted by a shutdown", run.ID)
+	default:
+		return statusError, fmt.Sprintf("Run %d %s", run.ID, humanStatus(run.Status))
+	}
+}
+
+func humanStatus(status db.RunStatus) string {
+	switch status {
+	case db.RunStatusTimedOut:
+		return "timed out"
+	default:
+		return "was " + string(status)
+	}
+}
+
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+
+	return string(runes[:n-1]) + "…"
+}
+
+// reportStatus sets the commit status of the run. Failures are only logged,
+// they never fail the run.
+func (r *GithubRepository) reportStatus(ctx context.Context, run *db.Run, pipeline config.BranchPipeline) {
+	// Check runs replace commit statuses when enabled.
+	if r.cfg.Checks {
+		return
+	}
+
+	state, description := statusState(run)
+	status := github.RepoStatus{
+		State:       github.Ptr(state),
+		Description: github.Ptr(description),
+		Context:     github.Ptr(statusContext(pipeline)),
+	}
+	if url := server.RunLogURL(r.logServer, run.ID); url != "" {
+		status.TargetURL = github.Ptr(url)
+	}
+
+	_, err := pkg.RequestWithRetry(context.WithoutCancel(ctx), func(tCtx context.Context) (*github.RepoStatus, error) {
+		created, _, err := r.client.Repositories.CreateStatus(tCtx, r.cfg.Owner, r.cfg.Repo, run.Commit, status)
+		return created, err
+	}, func(retryNumber int) {
+		zap.L().Warn(fmt.Sprintf("Retrying commit status of run %d, attempt %d", run.ID, retryNumber))
+	})
+	if err != nil {
+		zap.L().Error(fmt.Sprintf("Failed to set commit status of run %d: %v", run.ID, err))
+	}
+}
@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"home-ci-cd/config"
+	"home-ci-cd/db"
+	"home-ci-cd/pkg"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestReportStatus(t *testing.T) {
+	var got map[string]string
+	path := ""
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("malformed body: %v", err)
+		}
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	r := &GithubRepository{
+		cfg:       config.Repository{Owner: "owner", Repo: "repo"},
+		client:    NewGithubClient(GithubEndpoint{BaseURL: srv.URL, Transport: http.DefaultTransport}, "token"),
+		logServer: config.Server{ExternalURL: "https://ci.example.com/", SigningKey: "0123456789abcdef"},
+	}
+
+	run := &db.Run{ID: 12, Commit: "abc", Status: db.RunStatusTimedOut}
+	r.reportStatus(context.Background(), run, config.BranchPipeline{Template: "main"})
+
+	if path != "/api/v3/repos/owner/repo/statuses/abc" {
+		t.Fatalf("unexpected path %q", path)
+	}
+	want := map[string]string{
+		"state":       "error",
+		"description": "Run 12 timed out",
+		"context":     "home-ci-cd/main",
+		"target_url":  "https://ci.example.com/runs/12/log?sig=b89b0f489c11f6c8448450cea2594c6c3bc93b8b3c79d1d0f957e3277053eedf",
+	}
+	for key, value := range want {
+		if got[key] != value {
+			t.Fatalf("%s: got %q, want %q", key, got[key], value)
+		}
+	}
+}
+
+func TestStatusState(t *testing.T) {
+	tests := []struct {
+		status      db.RunStatus
+		state       string
+		description string
+	}{
+		{db.RunStatusTimedOut, "error", "Run 5 timed out"},
+		{db.RunStatusSuperseded, "pending", "Run 5 was superseded by a newer commit"},
+		{db.RunStatusInterrupted, "pending", "Run 5 was interrupted by a shutdown"},
+	}
+
+	for _, tt := range tests {
+		state, description := statusState(&db.Run{ID: 5, Status: tt.status})
+		if state != tt.state || description != tt.description {
+			t.Fatalf("%s: got %q %q, want %q %q", tt.status, state, description, tt.state, tt.description)
+		}
+	}
+}
+
+func TestStatusState_RedactsError(t *testing.T) {
+	pkg.AddSecrets("status-secret-value")
+
+	run := &db.Run{ID: 3, Status: db.RunStatusFailed, Error: "remote command 'deploy status-secret-value' failed"}
+	_, description := statusState(run)
+
+	if strings.Contains(description, "status-secret-value") {
+		t.Fatalf("description %q contains the secret", description)
+	}
+}
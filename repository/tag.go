@@ -0,0 +1,184 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"home-ci-cd/config"
+	"home-ci-cd/db"
+	"home-ci-cd/pkg"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v81/github"
+	"go.uber.org/zap"
+)
+
+const (
+	// Prefix of the lane and run branch of tag runs
+	tagBranchPrefix = "tags/"
+	// Docker limits image tags to 128 characters.
+	maxImageTag = 128
+)
+
+var (
+	invalidImageNameRegexp = regexp.MustCompile(`[^a-z0-9._-]+`)
+	invalidImageTagRegexp  = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+)
+
+// tagImage returns the image reference of a tag build, the repository name tagged with the git tag.
+func tagImage(repo, tag string) string {
+	name := strings.Trim(invalidImageNameRegexp.ReplaceAllString(strings.ToLower(repo), "-"), "._-")
+	if name == "" {
+		name = "image"
+	}
+
+	imageTag := invalidImageTagRegexp.ReplaceAllString(tag, "-")
+	if strings.HasPrefix(imageTag, ".") || strings.HasPrefix(imageTag, "-") {
+		imageTag = "_" + imageTag
+	}
+	if len(imageTag) > maxImageTag {
+		imageTag = imageTag[:maxImageTag]
+	}
+
+	return name + ":" + imageTag
+}
+
+// watchTags builds tags matching a tag pipeline once. Tags existing when the repository
+// is watched for the first time are recorded without building them.
+func (r *GithubRepository) watchTags(ctx context.Context) {
+	first := true
+	for {
+		if r.tags(ctx, first) {
+			first = false
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(r.client.RateLimit.Delay(watchPipelineSleepDuration)):
+		}
+	}
+}
+
+// tags queues runs of tags that were not built yet and reports whether the tags were listed.
+func (r *GithubRepository) tags(ctx context.Context, first bool) bool {
+	built, err := r.db.ListBuiltTags(ctx, r.cfg.Owner, r.cfg.Repo)
+	if err != nil {
+		zap.L().Error(err.Error())
+		return false
+	}
+
+	var tags []*github.RepositoryTag
+	opts := &github.ListOptions{PerPage: BranchListPerPageOption}
+	for {
+		page, resp, err := r.client.Repositories.ListTags(conditional(ctx), r.cfg.Owner, r.cfg.Repo, opts)
+		if err != nil {
+			zap.L().Error(err.Error())
+			return false
+		}
+		tags = append(tags, page...)
+
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	baseline := first && len(built) == 0
+	for _, tag := range tags {
+		name, commit := tag.GetName(), tag.GetCommit().GetSHA()
+		if _, ok := built[name]; ok {
+			continue
+		}
+
+		pipeline, ok, err := r.tagPipeline(name)
+		if err != nil {
+			zap.L().Error(err.Error())
+			continue
+		}
+		if !ok {
+			continue
+		}
+
+		if baseline {
+			zap.L().Info(fmt.Sprintf("Recording existing tag '%s' of %s/%s without building it", name, r.cfg.Owner, r.cfg.Repo))
+			if err = r.db.SaveBuiltTag(ctx, r.cfg.Owner, r.cfg.Repo, name, commit); err != nil {
+				zap.L().Error(err.Error())
+			}
+			continue
+		}
+
+		r.tag(ctx, name, commit, pipeline)
+	}
+
+	return true
+}
+
+func (r *GithubRepository) tag(ctx context.Context, name, commit string, pipeline config.BranchPipeline) {
+	// Runs outlive the watch context, they are stopped by Shutdown.
+	lr, err := r.enqueue(context.WithoutCancel(ctx), &db.Run{
+		Branch:  tagBranchPrefix + name,
+		Commit:  commit,
+		Trigger: db.RunTriggerTag,
+		Tag:     name,
+	}, pipeline)
+	if err != nil || lr == nil {
+		return
+	}
+
+	go func() {
+		<-lr.done
+		zap.L().Info(fmt.Sprintf(
+			"Pipeline completed for tag '%s' at commit '%s' with status '%s'",
+			name,
+			commit,
+			lr.run.Status,
+		))
+	}()
+}
+
+// tagPipeline returns the first tag pipeline whose template and version range match the tag.
+func (r *GithubRepository) tagPipeline(tag string) (config.BranchPipeline, bool, error) {
+	for _, tagPipeline := range r.cfg.TagPipelines {
+		match, err := tagPipeline.MatchBranch(tag)
+		if err != nil {
+			return config.BranchPipeline{}, false, err
+		}
+		if !match {
+			continue
+		}
+
+		if tagPipeline.Versions != "" {
+			versions, err := pkg.ParseVersionRange(tagPipeline.Versions)
+			if err != nil {
+				return config.BranchPipeline{}, false, err
+			}
+			version, err := pkg.ParseVersion(tag)
+			if err != nil || !versions.Contains(version) {
+				continue
+			}
+		}
+
+		pipeline := tagPipeline.BranchPipeline
+		if pipeline.StatusContext == "" {
+			pipeline.StatusContext = statusContextPrefix + "tag/" + pipeline.Template
+		}
+
+		return pipeline, true, nil
+	}
+
+	return config.BranchPipeline{}, false, nil
+}
+
+// finishTag records the tag as built. Superseded and interrupted runs
+// are not recorded, so the tag is built again on the next poll.
+func (r *GithubRepository) finishTag(ctx context.Context, run *db.Run) {
+	if run.Status == db.RunStatusSuperseded || run.Status == db.RunStatusInterrupted {
+		return
+	}
+
+	if err := r.db.SaveBuiltTag(ctx, r.cfg.Owner, r.cfg.Repo, run.Tag, run.Commit); err != nil {
+		zap.L().Error(err.Error())
+	}
+}
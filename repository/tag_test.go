@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"context"
+	"home-ci-cd/config"
+	"home-ci-cd/db"
+	"path/filepath"
+	"testing"
+)
+
+func TestTagPipeline(t *testing.T) {
+	r := &GithubRepository{cfg: config.Repository{
+		TagPipelines: []config.TagPipeline{
+			{Versions: ">=2.0.0", BranchPipeline: config.BranchPipeline{Template: "v*", StatusContext: "release"}},
+			{BranchPipeline: config.BranchPipeline{Template: "nightly-*"}},
+		},
+	}}
+
+	tests := []struct {
+		tag     string
+		ok      bool
+		context string
+	}{
+		{"v2.1.0", true, "release"},
+		{"v1.9.0", false, ""},
+		{"v2.1.0-rc.1", false, ""},
+		{"vnext", false, ""},
+		{"nightly-2026-10-18", true, "home-ci-cd/tag/nightly-*"},
+	}
+
+	for _, tt := range tests {
+		pipeline, ok, err := r.tagPipeline(tt.tag)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", tt.tag, err)
+		}
+		if ok != tt.ok || pipeline.StatusContext != tt.context {
+			t.Fatalf("%s: got %v %q, want %v %q", tt.tag, ok, pipeline.StatusContext, tt.ok, tt.context)
+		}
+	}
+}
+
+func TestTagImage(t *testing.T) {
+	for repo, want := range map[string]string{
+		"Home-CI":   "home-ci:v1.2.3",
+		"my repo!":  "my-repo:v1.2.3",
+		"__":        "image:v1.2.3",
+		"service.a": "service.a:v1.2.3",
+	} {
+		if got := tagImage(repo, "v1.2.3"); got != want {
+			t.Fatalf("tagImage(%q) = %q, want %q", repo, got, want)
+		}
+	}
+
+	if got := tagImage("repo", "release/1.0+build"); got != "repo:release-1.0-build" {
+		t.Fatalf("unexpected image %q", got)
+	}
+}
+
+func TestPreviousDeployment_TagRun(t *testing.T) {
+	database, err := db.NewBoltDB(filepath.Join(t.TempDir(), "test.db"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = database.Close() })
+
+	r := &GithubRepository{cfg: config.Repository{Owner: "owner", Repo: "repo"}, db: database}
+	ctx := context.Background()
+	pipeline := config.BranchPipeline{Template: "v*"}
+
+	for _, run := range []*db.Run{
+		{Branch: "tags/v1.0.0", Commit: "a1", Trigger: db.RunTriggerTag, Tag: "v1.0.0", Pipeline: "v*", Status: db.RunStatusSuccess},
+		{Branch: "main", Commit: "b2", Trigger: db.RunTriggerPush, Pipeline: "v*", Status: db.RunStatusSuccess},
+		{Branch: "tags/v1.1.0", Commit: "c3", Trigger: db.RunTriggerTag, Tag: "v1.1.0", Pipeline: "v*", Status: db.RunStatusSuccess, DeploySkipped: true},
+	} {
+		run.Owner, run.Repo = "owner", "repo"
+		if err := database.SaveRun(ctx, run); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The failing tag has a branch of its own, the last deployed tag is rolled back to.
+	run := &db.Run{Branch: "tags/v1.2.0", Commit: "d4", Trigger: db.RunTriggerTag, Tag: "v1.2.0", Status: db.RunStatusRunning}
+	previous, err := r.previousDeployment(ctx, run, pipeline)
+	if err != nil || previous.Commit != "a1" {
+		t.Fatalf("previousDeployment() = %q, %v, want a1", previous.Commit, err)
+	}
+
+	run = &db.Run{Branch: "main", Commit: "e5", Trigger: db.RunTriggerPush, Status: db.RunStatusRunning}
+	previous, err = r.previousDeployment(ctx, run, pipeline)
+	if err != nil || previous.Commit != "b2" {
+		t.Fatalf("previousDeployment() = %q, %v, want b2", previous.Commit, err)
+	}
+}
@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"home-ci-cd/config"
+	"time"
+)
+
+// defaultRollbackTimeout bounds rollbacks of pipelines without a deploy timeout.
+const defaultRollbackTimeout = 10 * time.Minute
+
+// withTimeout limits ctx to timeout when it is set. The cause of the deadline names what timed out.
+func withTimeout(ctx context.Context, name string, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeoutCause(ctx, timeout, fmt.Errorf("%w: %s exceeded %s", ErrTimedOut, name, timeout))
+}
+
+// timedOut replaces err with the timeout cause when err was caused by a deadline set by withTimeout.
+func timedOut(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	if cause := context.Cause(ctx); errors.Is(cause, ErrTimedOut) {
+		return cause
+	}
+
+	return err
+}
+
+// stage runs fn with the stage timeout.
+func stage(ctx context.Context, name string, timeout time.Duration, fn func(ctx context.Context) error) error {
+	ctx, cancel := withTimeout(ctx, name+" stage", timeout)
+	defer cancel()
+
+	return timedOut(ctx, fn(ctx))
+}
+
+// withRollbackTimeout detaches the rollback from ctx, which may be done already when the deploy
+// timed out or the run is canceled, and limits it to the rollback timeout of the pipeline.
+func withRollbackTimeout(ctx context.Context, pipeline config.BranchPipeline) (context.Context, context.CancelFunc) {
+	timeout := pipeline.StageTimeouts.Rollback
+	if timeout <= 0 {
+		timeout = pipeline.StageTimeouts.Deploy
+	}
+	if timeout <= 0 {
+		timeout = defaultRollbackTimeout
+	}
+
+	return withTimeout(context.WithoutCancel(ctx), "rollback", timeout)
+}
@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"home-ci-cd/config"
+	"testing"
+	"time"
+)
+
+func TestStage_ReportsTimeout(t *testing.T) {
+	err := stage(context.Background(), "build", 10*time.Millisecond, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	if !errors.Is(err, ErrTimedOut) {
+		t.Fatalf("expected ErrTimedOut, got %v", err)
+	}
+	if err.Error() != "timed out: build stage exceeded 10ms" {
+		t.Fatalf("unexpected error %q", err)
+	}
+}
+
+func TestStage_PipelineTimeoutWins(t *testing.T) {
+	ctx, cancel := withTimeout(context.Background(), "pipeline", 10*time.Millisecond)
+	defer cancel()
+
+	err := stage(ctx, "deploy", time.Minute, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	if err == nil || err.Error() != "timed out: pipeline exceeded 10ms" {
+		t.Fatalf("expected pipeline timeout, got %v", err)
+	}
+}
+
+func TestStage_KeepsOtherErrors(t *testing.T) {
+	errFailed := errors.New("failed")
+
+	err := stage(context.Background(), "download", 0, func(ctx context.Context) error {
+		return errFailed
+	})
+
+	if !errors.Is(err, errFailed) || errors.Is(err, ErrTimedOut) {
+		t.Fatalf("expected original error, got %v", err)
+	}
+}
+
+func TestWithRollbackTimeout(t *testing.T) {
+	ctx, cancel := withTimeout(context.Background(), "deploy stage", time.Millisecond)
+	defer cancel()
+	<-ctx.Done()
+
+	tests := []struct {
+		timeouts config.StageTimeouts
+		want     time.Duration
+	}{
+		{config.StageTimeouts{Deploy: time.Minute, Rollback: 2 * time.Minute}, 2 * time.Minute},
+		{config.StageTimeouts{Deploy: time.Minute}, time.Minute},
+		{config.StageTimeouts{}, defaultRollbackTimeout},
+	}
+
+	for _, tt := range tests {
+		rollbackCtx, rollbackCancel := withRollbackTimeout(ctx, config.BranchPipeline{StageTimeouts: tt.timeouts})
+		if rollbackCtx.Err() != nil {
+			t.Fatalf("%+v: rollback must outlive the timed out deploy", tt.timeouts)
+		}
+		deadline, ok := rollbackCtx.Deadline()
+		if left := time.Until(deadline); !ok || left > tt.want || left < tt.want-time.Second {
+			t.Fatalf("%+v: got deadline in %v, want %v", tt.timeouts, left, tt.want)
+		}
+		rollbackCancel()
+	}
+}
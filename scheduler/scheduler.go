@@ -0,0 +1,192 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"home-ci-cd/config"
+	"slices"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultWorkers = 1
+)
+
+// Job describes a pipeline run waiting for a worker.
+type Job struct {
+	// Repository as owner/repo
+	Repository string
+	// Pipeline template within the repository
+	Pipeline string
+	// Branch the run builds, used in logs
+	Branch string
+	// Runs of the repository executed at the same time, unlimited when zero
+	RepositoryLimit int
+	// Runs of the pipeline executed at the same time, unlimited when zero
+	PipelineLimit int
+}
+
+func (j Job) pipelineKey() string {
+	return j.Repository + "\x00" + j.Pipeline
+}
+
+func (j Job) String() string {
+	return fmt.Sprintf("%s branch '%s'", j.Repository, j.Branch)
+}
+
+// Scheduler limits the number of pipeline runs executed at the same time globally,
+// per repository and per pipeline. Runs beyond the limits wait in FIFO order:
+// a freed worker goes to the oldest waiting run whose limits allow it to start.
+type Scheduler struct {
+	mu          sync.Mutex
+	workers     int
+	running     int
+	byRepo      map[string]int
+	byPipeline  map[string]int
+	queue       []*waiter
+	perRepo     int
+	perPipeline int
+}
+
+type waiter struct {
+	job     Job
+	granted bool
+	ready   chan struct{}
+}
+
+// NewScheduler creates a scheduler with the configured limits.
+func NewScheduler(cfg config.Concurrency) *Scheduler {
+	workers := cfg.Workers
+	if workers <= 0 {
+		workers = defaultWorkers
+	}
+
+	return &Scheduler{
+		workers:     workers,
+		byRepo:      make(map[string]int),
+		byPipeline:  make(map[string]int),
+		perRepo:     cfg.PerRepository,
+		perPipeline: cfg.PerPipeline,
+	}
+}
+
+// Limits returns the repository and pipeline limits of the job, falling back to the
+// configured defaults when the repository or pipeline does not set its own.
+func (s *Scheduler) Limits(repository config.Repository, pipeline config.BranchPipeline) (int, int) {
+	repoLimit := repository.MaxConcurrency
+	if repoLimit == 0 {
+		repoLimit = s.perRepo
+	}
+	pipelineLimit := pipeline.MaxConcurrency
+	if pipelineLimit == 0 {
+		pipelineLimit = s.perPipeline
+	}
+
+	return repoLimit, pipelineLimit
+}
+
+// Acquire blocks until the job may run or ctx is done.
+// The returned function frees the worker and must be called once the run finishes.
+func (s *Scheduler) Acquire(ctx context.Context, job Job) (func(), error) {
+	w := &waiter{
+		job:   job,
+		ready: make(chan struct{}),
+	}
+
+	s.mu.Lock()
+	s.queue = append(s.queue, w)
+	s.dispatch()
+	if w.granted {
+		s.mu.Unlock()
+		return s.releaseFunc(job), nil
+	}
+	depth := len(s.queue)
+	s.mu.Unlock()
+
+	zap.L().Info(fmt.Sprintf("Run of %s is queued, queue depth %d", job, depth))
+
+	select {
+	case <-w.ready:
+		zap.L().Info(fmt.Sprintf("Run of %s is dequeued, queue depth %d", job, s.QueueDepth()))
+		return s.releaseFunc(job), nil
+	case <-ctx.Done():
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if w.granted {
+		s.release(job)
+	} else {
+		s.queue = slices.DeleteFunc(s.queue, func(q *waiter) bool { return q == w })
+	}
+
+	return nil, ctx.Err()
+}
+
+// QueueDepth returns the number of runs waiting for a worker.
+func (s *Scheduler) QueueDepth() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.queue)
+}
+
+func (s *Scheduler) releaseFunc(job Job) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+
+			s.release(job)
+		})
+	}
+}
+
+// release frees the worker of the job and starts waiting runs. Must be called with mu held.
+func (s *Scheduler) release(job Job) {
+	s.running--
+	s.byRepo[job.Repository]--
+	if s.byRepo[job.Repository] == 0 {
+		delete(s.byRepo, job.Repository)
+	}
+	s.byPipeline[job.pipelineKey()]--
+	if s.byPipeline[job.pipelineKey()] == 0 {
+		delete(s.byPipeline, job.pipelineKey())
+	}
+
+	s.dispatch()
+}
+
+// dispatch starts queued runs in FIFO order while workers are free. Must be called with mu held.
+func (s *Scheduler) dispatch() {
+	i := 0
+	for i < len(s.queue) && s.running < s.workers {
+		w := s.queue[i]
+		if !s.fits(w.job) {
+			i++
+			continue
+		}
+
+		s.running++
+		s.byRepo[w.job.Repository]++
+		s.byPipeline[w.job.pipelineKey()]++
+		w.granted = true
+		close(w.ready)
+		s.queue = slices.Delete(s.queue, i, i+1)
+	}
+}
+
+func (s *Scheduler) fits(job Job) bool {
+	if job.RepositoryLimit > 0 && s.byRepo[job.Repository] >= job.RepositoryLimit {
+		return false
+	}
+	if job.PipelineLimit > 0 && s.byPipeline[job.pipelineKey()] >= job.PipelineLimit {
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,99 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"home-ci-cd/config"
+	"testing"
+	"time"
+)
+
+func acquireAsync(s *Scheduler, job Job) chan func() {
+	ch := make(chan func(), 1)
+	go func() {
+		release, err := s.Acquire(context.Background(), job)
+		if err == nil {
+			ch <- release
+		}
+	}()
+	return ch
+}
+
+func waitQueued(t *testing.T, s *Scheduler, depth int) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for s.QueueDepth() != depth {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected queue depth %d, got %d", depth, s.QueueDepth())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestScheduler_FIFOWithinLimits(t *testing.T) {
+	s := NewScheduler(config.Concurrency{Workers: 2})
+
+	a := Job{Repository: "owner/a", Pipeline: "main", RepositoryLimit: 1}
+	b := Job{Repository: "owner/b", Pipeline: "main"}
+
+	releaseA, err := s.Acquire(context.Background(), a)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// The second run of repository a waits for the repository limit.
+	secondA := acquireAsync(s, a)
+	waitQueued(t, s, 1)
+
+	// A run of another repository skips it and takes the free worker.
+	releaseB, err := s.Acquire(context.Background(), b)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// Now every worker is busy, so the next run of b queues behind a.
+	secondB := acquireAsync(s, b)
+	waitQueued(t, s, 2)
+
+	releaseA()
+	select {
+	case release := <-secondA:
+		release()
+	case <-time.After(time.Second):
+		t.Fatal("queued run of a did not start")
+	}
+
+	releaseB()
+	select {
+	case release := <-secondB:
+		release()
+	case <-time.After(time.Second):
+		t.Fatal("queued run of b did not start")
+	}
+
+	if s.QueueDepth() != 0 || s.running != 0 {
+		t.Fatalf("expected idle scheduler, got depth %d running %d", s.QueueDepth(), s.running)
+	}
+}
+
+func TestScheduler_AcquireCanceled(t *testing.T) {
+	s := NewScheduler(config.Concurrency{})
+	job := Job{Repository: "owner/repo", Pipeline: "main"}
+
+	release, err := s.Acquire(context.Background(), job)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if _, err = s.Acquire(ctx, job); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if s.QueueDepth() != 0 {
+		t.Fatalf("expected empty queue, got %d", s.QueueDepth())
+	}
+}
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"home-ci-cd/config"
+	"home-ci-cd/db"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	readHeaderTimeout = time.Second * 10
+	// Query parameter of run log links holding their signature
+	signatureParam = "sig"
+)
+
+// Server serves run logs over HTTP, so commit statuses can link to them.
+// Run IDs are sequential, only links signed with the signing key are served.
+type Server struct {
+	db         db.DB
+	server     *http.Server
+	signingKey string
+}
+
+// NewServer creates a server listening on the configured address.
+func NewServer(cfg config.Server, database db.DB) *Server {
+	s := &Server{db: database, signingKey: cfg.SigningKey}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /runs/{id}/log", s.runLog)
+
+	s.server = &http.Server{
+		Addr:              cfg.Listen,
+		Handler:           mux,
+		ReadHeaderTimeout: readHeaderTimeout,
+	}
+
+	return s
+}
+
+// Handler returns the handler serving requests.
+func (s *Server) Handler() http.Handler {
+	return s.server.Handler
+}
+
+// Start listens in the background until Shutdown.
+func (s *Server) Start() {
+	go func() {
+		zap.L().Info(fmt.Sprintf("Serving run logs on '%s'", s.server.Addr))
+		if err := s.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			zap.L().Error(err.Error())
+		}
+	}()
+}
+
+// Shutdown stops the server, waiting for active requests until ctx is done.
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.server.Shutdown(ctx)
+}
+
+func (s *Server) runLog(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid run id", http.StatusBadRequest)
+		return
+	}
+
+	signature, err := hex.DecodeString(r.URL.Query().Get(signatureParam))
+	if err != nil || s.signingKey == "" || !hmac.Equal(signature, sign(s.signingKey, id)) {
+		http.Error(w, "invalid run log link", http.StatusForbidden)
+		return
+	}
+
+	log, err := s.db.GetRunLog(r.Context(), id)
+	switch {
+	case errors.Is(err, db.ErrRunNotFound):
+		http.NotFound(w, r)
+		return
+	case err != nil:
+		zap.L().Error(err.Error())
+		http.Error(w, "failed to read run log", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = w.Write(log)
+}
+
+// RunLogURL returns the signed address of the run log, empty when the server has no external URL.
+func RunLogURL(cfg config.Server, id uint64) string {
+	if cfg.ExternalURL == "" {
+		return ""
+	}
+
+	return fmt.Sprintf(
+		"%s/runs/%d/log?%s=%s",
+		strings.TrimSuffix(cfg.ExternalURL, "/"),
+		id,
+		signatureParam,
+		hex.EncodeToString(sign(cfg.SigningKey, id)),
+	)
+}
+
+func sign(key string, id uint64) []byte {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(strconv.FormatUint(id, 10)))
+	return mac.Sum(nil)
+}
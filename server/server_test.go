@@ -0,0 +1,64 @@
+package server
+
+import (
+	"context"
+	"home-ci-cd/config"
+	"home-ci-cd/db"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestServer_RunLog(t *testing.T) {
+	database, err := db.NewBoltDB(filepath.Join(t.TempDir(), "test.db"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = database.Close() })
+
+	run := &db.Run{Owner: "owner", Repo: "repo"}
+	if err := database.SaveRun(context.Background(), run); err != nil {
+		t.Fatalf("failed to save run: %v", err)
+	}
+	if err := database.SaveRunLog(context.Background(), run.ID, []byte("build output\n")); err != nil {
+		t.Fatalf("failed to save log: %v", err)
+	}
+
+	cfg := config.Server{SigningKey: "0123456789abcdef"}
+	srv := httptest.NewServer(NewServer(cfg, database).Handler())
+	defer srv.Close()
+	cfg.ExternalURL = srv.URL
+
+	resp, err := http.Get(RunLogURL(cfg, run.ID))
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "build output\n" {
+		t.Fatalf("unexpected response %d %q", resp.StatusCode, body)
+	}
+
+	forged := config.Server{ExternalURL: srv.URL, SigningKey: "another key of 16"}
+	for _, url := range []string{srv.URL + "/runs/1/log", RunLogURL(forged, run.ID)} {
+		resp, err = http.Get(url)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusForbidden {
+			t.Fatalf("%s: expected 403, got %d", url, resp.StatusCode)
+		}
+	}
+
+	resp, err = http.Get(RunLogURL(cfg, 99))
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", resp.StatusCode)
+	}
+}